@@ -3,65 +3,83 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
+	"path/filepath"
 
 	"anybakup/util"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	addExclude []string
+	addMirror  bool
 )
 
 // addCmd represents the add command
 var addCmd = &cobra.Command{
-	Use:   "add [file]",
-	Short: "Add a file to the repository",
-	Long:  `Add a file to the repository. This copies the file to the configured repository directory.`,
-	Args:  cobra.ExactArgs(1),
+	Use:   "add [file|dir|glob]...",
+	Short: "Add files to the repository",
+	Long: `Add files to the repository. This copies the files to the configured repository directory.
+Many paths and shell-style glob patterns may be given; they are all backed up in a single commit.
+--exclude takes gitignore-style rules such as "node_modules/" or "*.o" that are skipped in the
+given directories from now on; rules for all directories go in the exclude list of the profile.
+--mirror makes the backup of a directory match the source: files deleted at the source are removed.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		profile, err := ShowProfileOption()
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		g := NewGitCmd(profile)
+		g := profileGitCmd()
 		tag, _ := GetTagOption(g.C)
-		if ret := g.AddFile(args[0]); ret.Err != nil {
-			fmt.Printf("Error add file %v: [%v]\n", args[0], ret.Err)
-			os.Exit(1)
-		} else {
+		rets := g.AddFilesWith(args, AddOptions{Exclude: addExclude, Mirror: addMirror}, tag)
+		failed := false
+		for _, ret := range rets {
+			if ret.Err != nil {
+				logrus.Errorf("Error add file %v: [%v]", ret.Src, ret.Err)
+				failed = true
+				continue
+			}
+			for _, f := range ret.Excluded {
+				logrus.Warnf("excluded %s is still in the backup, remove it with rm", f)
+			}
+			if jsonOutput() {
+				continue
+			}
 			if tag != "" {
-
 				for _, f := range ret.Files {
-					if err := SetFileTag(f, tag, g.C); err != nil {
-						fmt.Println(err)
-					} else {
-						fmt.Println(f.Sting(), "Set Tag", tag)
-					}
+					fmt.Println(f.Sting(), "Set Tag", tag)
 				}
 			}
-			fmt.Printf("add %s to %s\n", args[0], ret.Dest)
+			fmt.Printf("add %s to %s\n", ret.Src, ret.Dest)
+			for _, f := range ret.Deleted {
+				fmt.Printf("rm %s\n", f)
+			}
+		}
+		if jsonOutput() {
+			printJSON(rets)
+		}
+		if failed {
+			os.Exit(1)
 		}
 	},
 }
 
-func runListFile(filePath string, print bool) []util.GitChanges {
-	profile, err := ShowProfileOption()
+func runListFile(g *GitCmd, filePath string, print bool) []util.GitChanges {
+	logs, err := g.GetPathLogAbs(filePath)
 	if err != nil {
-		fmt.Println(err)
-		return nil
-	}
-	g := NewGitCmd(profile)
-	if logs, err := g.GetFileLogAbs(filePath); err != nil {
-		fmt.Printf("Error log file %v: [%v]\n", filePath, err)
+		logrus.Errorf("Error log file %v: [%v]", filePath, err)
 		return []util.GitChanges{}
-	} else if print {
-		for i, l := range logs {
-			fmt.Printf("%3d: %-10s %-10s %-10s\n", i+1, l.Commit, l.Author, l.Date)
-		}
+	}
+	if !print {
 		return logs
-	} else {
+	}
+	if jsonOutput() {
+		printJSON(logs)
 		return logs
 	}
+	for i, l := range logs {
+		fmt.Printf("%3d: %-10s %-10s %-10s\n", i+1, l.Commit, l.Author, l.Date)
+	}
+	return logs
 }
 
 var logCmd = &cobra.Command{
@@ -71,59 +89,95 @@ var logCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath := args[0]
-		runListFile(filePath, true)
+		runListFile(profileGitCmd(), filePath, true)
 	},
 }
 
+var (
+	getAt     string
+	getBefore string
+)
+
 var getCmd = &cobra.Command{
-	Use:   "get [file] [target] [commit]",
-	Short: "get a file from the repository",
-	Long:  `get a file from the repository. This copies the file to the configured repository directory.`,
-	Args:  cobra.RangeArgs(1, 3),
+	Use:   "get [file|dir] [target] [commit]",
+	Short: "get a file or directory from the repository",
+	Long: `get a file or directory from the repository. A directory is exported below target with the file modes stored in the backup.
+Instead of a commit, --at selects the newest backup at or before a time such as
+"2026-09-01 12:00", "yesterday 18:00" or "3d"; --before takes a time only.`,
+	Args: cobra.RangeArgs(1, 3),
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath := args[0]
 		target := ""
 		commit := ""
-		profile, err := ShowProfileOption()
-		if err != nil {
-			fmt.Println(err)
-			return
+		g := profileGitCmd()
+		at := getAt
+		if getBefore != "" {
+			if at != "" {
+				fatalf("Error: --at and --before are mutually exclusive")
+			}
+			if _, err := util.ParseAt(getBefore); err != nil {
+				fatalf("Error get file %v: [%v]", filePath, err)
+			}
+			at = getBefore
 		}
-		g := NewGitCmd(profile)
-		if len(args) == 3 {
+		if len(args) > 1 {
 			target = args[1]
+		}
+		if len(args) == 3 {
 			commit = args[2]
-		} else {
-			runListFile(filePath, true)
+		}
+		if target == "" || (commit == "" && at == "") {
+			runListFile(g, filePath, true)
 			os.Exit(1)
 		}
+		if commit != "" && at != "" {
+			fatalf("Error: a commit and --at/--before are mutually exclusive")
+		}
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			fatalf("Error get file %v: [%v]", filePath, err)
+		}
+		repoPath := util.SrcPath(absPath).Repo()
 		// try to convert commit to int
 		if commit != "" {
-			logs := runListFile(filePath, false)
-			commit = strings.TrimSpace(commit)
-			if n, err := strconv.Atoi(commit); err == nil {
-				commit = logs[n-1].Commit
-			} else {
-				fmt.Printf("Error get file %v: [%v]\n", filePath, err)
-				os.Exit(1)
+			logs := runListFile(g, filePath, false)
+			if commit, err = resolveCommitArg(logs, commit); err != nil {
+				fatalf("Error get file %v: [%v]", filePath, err)
 			}
+		} else if commit, err = g.ResolveAt(repoPath, at); err != nil {
+			fatalf("Error get file %v: [%v]", filePath, err)
 		}
-		if err := g.GetFile(util.SrcPath(filePath).Repo(), commit, target); err != nil {
-			fmt.Printf("Error get file %v: [%v]\n", filePath, err)
-			os.Exit(1)
+		entries, err := g.ExportFile(repoPath, commit, target)
+		if err != nil {
+			fatalf("Error get file %v: [%v]", filePath, err)
+		}
+		if jsonOutput() {
+			printJSON(getResult{Src: absPath, Dest: repoPath, Commit: commit, Target: target, Files: entries})
+		} else if commit == "" {
+			fmt.Printf("get %s from HEAD to %s\n", filePath, target)
 		} else {
-			if commit == "" {
-				fmt.Printf("get %s from HEAD to %s\n", filePath, target)
-			} else {
-				fmt.Printf("get %s from %s to %s\n", filePath, commit, target)
-			}
-			os.Exit(0)
+			fmt.Printf("get %s from %s to %s\n", filePath, commit, target)
 		}
 	},
 }
 
+// getResult is the json output of get
+type getResult struct {
+	Src    string              `json:"src"`
+	Dest   util.RepoPath       `json:"dest"`
+	Commit string              `json:"commit"`
+	Target string              `json:"target"`
+	Files  []util.RestoreEntry `json:"files"`
+}
+
 func init() {
+	addCmd.Flags().String("tag", "", "tag the added files instead of asking")
+	viper.BindPFlag("tag", addCmd.Flags().Lookup("tag"))
+	addCmd.Flags().StringArrayVar(&addExclude, "exclude", nil, "gitignore-style rule to skip in added directories (repeatable)")
+	addCmd.Flags().BoolVar(&addMirror, "mirror", false, "remove files from the backup of a directory that were deleted at the source")
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(logCmd)
+	getCmd.Flags().StringVar(&getAt, "at", "", "commit or time to get the version from")
+	getCmd.Flags().StringVar(&getBefore, "before", "", "get the newest version at or before this time")
 	rootCmd.AddCommand(getCmd)
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"anybakup/util"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloneDir     string
+	cloneDefault bool
+)
+
+// GitCloneProfile clones the backup repository at url into repoPath,
+// rebuilds file_operations.db from the repository and registers it as
+// profile with url as its origin remote. The profile becomes the default with
+// makeDefault or when the config has no default. If the rebuild fails the
+// clone is removed and the config is left unchanged.
+func GitCloneProfile(url, profile, repoPath string, makeDefault bool) ([]FileOperation, error) {
+	if profile == "" {
+		profile = "default"
+	}
+	c := &util.Config{}
+	if err := c.Load(); err != nil {
+		return nil, err
+	}
+	if _, ok := c.Profile[profile]; ok {
+		return nil, fmt.Errorf("profile %q already exists", profile)
+	}
+	if err := util.GitClone(url, repoPath); err != nil {
+		return nil, err
+	}
+	p := util.Profile{RepoDir: util.RepoRoot(repoPath)}
+	p.Remotes = map[string]util.Remote{"origin": {URL: url}}
+	// rebuild against the profile before it is saved to the config
+	pending := *c
+	pending.Profile = maps.Clone(c.Profile)
+	if pending.Profile == nil {
+		pending.Profile = make(map[string]util.Profile)
+	}
+	pending.Profile[profile] = p
+	g, err := GitCmdFor(&pending, profile)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := g.RebuildIndex()
+	if err != nil {
+		if rmErr := os.RemoveAll(repoPath); rmErr != nil {
+			logrus.Warnf("remove clone %v: %v", repoPath, rmErr)
+		}
+		return nil, fmt.Errorf("error rebuilding index: %v", err)
+	}
+	if err := c.AddProfile(profile, p, makeDefault); err != nil {
+		return nil, fmt.Errorf("error saving config: %v", err)
+	}
+	return ops, nil
+}
+
+// cloneResult is the json output of clone
+type cloneResult struct {
+	Profile string        `json:"profile"`
+	RepoDir util.RepoRoot `json:"repodir"`
+	Tracked int           `json:"tracked"`
+}
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone [url|path] [profile]",
+	Short: "Clone an existing backup repository",
+	Long: `Clone a backup repository, for example one pushed from another machine, and register it as a profile.
+The file index is rebuilt from the git history, so log, status and restore work right away;
+exclude rules given with add --exclude are not part of the repository and are lost.
+The repository is cloned into --dir, by default $XDG_DATA_HOME/anybakup/<profile>.
+The profile only becomes the default with --default or when there is no default profile yet.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		url := remoteURL(args[0])
+		profile := "default"
+		if len(args) > 1 {
+			profile = args[1]
+		}
+		dir := cloneDir
+		if dir == "" {
+			data, err := util.DataDir()
+			if err != nil {
+				fatalf("%v", err)
+			}
+			dir = filepath.Join(data, profile)
+		}
+		absPath, err := filepath.Abs(dir)
+		if err != nil {
+			fatalf("Error getting absolute path: %v", err)
+		}
+		ops, err := GitCloneProfile(url, profile, absPath, cloneDefault)
+		if err != nil {
+			fatalf("Error cloning: %v", err)
+		}
+		tracked := countTracked(ops)
+		if jsonOutput() {
+			printJSON(cloneResult{Profile: profile, RepoDir: util.RepoRoot(absPath), Tracked: tracked})
+			return
+		}
+		fmt.Printf("Cloned %s into profile %s at %v, %d tracked paths\n", url, profile, absPath, tracked)
+	},
+}
+
+func init() {
+	cloneCmd.Flags().StringVar(&cloneDir, "dir", "", "directory to clone into")
+	cloneCmd.Flags().BoolVar(&cloneDefault, "default", false, "make the cloned profile the default")
+	rootCmd.AddCommand(cloneCmd)
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"anybakup/util"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffContext  int
+	diffWorktree bool
+)
+
+// resolveCommitArg converts a 1-based index from `anybakup log` into a commit
+// hash. Anything that is not an index is passed through as a revision.
+func resolveCommitArg(logs []util.GitChanges, arg string) (string, error) {
+	arg = strings.TrimSpace(arg)
+	if n, err := strconv.Atoi(arg); err == nil && len(arg) < 7 {
+		if n < 1 || n > len(logs) {
+			return "", fmt.Errorf("commit index %d out of range 1-%d", n, len(logs))
+		}
+		return logs[n-1].Commit, nil
+	}
+	return arg, nil
+}
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [file] [commit] [commit]",
+	Short: "Show changes of a file",
+	Long: `Show a unified diff of a backed up file.
+With no commit the last backup is compared with the live source file or
+directory, so drift can be checked before running add again. Use --worktree
+to compare the uncommitted copy in the repo instead.
+With one commit that version is compared with the live source file.
+With two commits the two historical versions are compared.
+A commit is either a hash or the index printed by 'anybakup log'.`,
+	Args: cobra.RangeArgs(1, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath := args[0]
+		g := profileGitCmd()
+		commits := []string{}
+		if len(args) > 1 {
+			logs, err := g.GetFileLogAbs(filePath)
+			if err != nil {
+				fatalf("Error diff file %v: [%v]", filePath, err)
+			}
+			for _, arg := range args[1:] {
+				commit, err := resolveCommitArg(logs, arg)
+				if err != nil {
+					fatalf("Error diff file %v: [%v]", filePath, err)
+				}
+				commits = append(commits, commit)
+			}
+		}
+		var diff string
+		var err error
+		if len(commits) == 0 && !diffWorktree {
+			diff, err = g.DriftFile(filePath, diffContext)
+		} else {
+			diff, err = g.DiffFile(filePath, diffContext, commits...)
+		}
+		if err != nil {
+			fatalf("Error diff file %v: [%v]", filePath, err)
+		}
+		fmt.Print(diff)
+	},
+}
+
+func init() {
+	diffCmd.Flags().IntVarP(&diffContext, "unified", "U", util.DefaultDiffContext, "number of context lines")
+	diffCmd.Flags().BoolVar(&diffWorktree, "worktree", false, "compare the repo copy instead of the last commit")
+	rootCmd.AddCommand(diffCmd)
+}
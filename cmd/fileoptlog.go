@@ -9,19 +9,21 @@ import (
 	"time"
 
 	"anybakup/util"
+
+	"github.com/sirupsen/logrus"
 	_ "modernc.org/sqlite"
 )
 
 type FileOperation struct {
-	ID         int64
-	SrcFile    string
-	DestFile   string
-	IsFile     bool
-	RevCount   int
-	Sub        bool
-	Tag        string
-	AddTime    time.Time
-	UpdateTime time.Time
+	ID         int64     `json:"id"`
+	SrcFile    string    `json:"srcfile"`
+	DestFile   string    `json:"destfile"`
+	IsFile     bool      `json:"isfile"`
+	RevCount   int       `json:"revcount"`
+	Sub        bool      `json:"sub"`
+	Tag        string    `json:"tag"`
+	AddTime    time.Time `json:"add_time"`
+	UpdateTime time.Time `json:"update_time"`
 }
 
 type sqldb struct {
@@ -64,6 +66,18 @@ func NewSqldb(c *util.Config) (*sqldb, error) {
 		return nil, fmt.Errorf("failed to create table: %v", err)
 	}
 
+	// exclude rules given with add --exclude, one row per tracked directory
+	createExcludesSQL := `
+	CREATE TABLE IF NOT EXISTS excludes (
+		destfile TEXT PRIMARY KEY,
+		rules TEXT NOT NULL
+	);
+	`
+	if _, err := db.Exec(createExcludesSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create table: %v", err)
+	}
+
 	s := &sqldb{
 		db:     db,
 		dbfile: dbPath,
@@ -76,6 +90,13 @@ func (s *sqldb) Close() error {
 	return s.db.Close()
 }
 
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 func BakupOptAdd(srcFile string, destFile util.RepoPath, isFile bool, sub bool, g GitCmd) error {
 	destFile = destFile.UnixStyle()
 	revcount := 0
@@ -93,14 +114,110 @@ func BakupOptAdd(srcFile string, destFile util.RepoPath, isFile bool, sub bool,
 		return err
 	}
 	defer db.Close()
+	folders, _ := db_query_folders(db.db)
+	return db_add_opt(db.db, srcFile, destFile, isFile, sub, revcount, folders)
+}
+
+// BakupEntry is one tracked path recorded by BakupOptAddBatch
+type BakupEntry struct {
+	SrcFile  string
+	DestFile util.RepoPath
+	IsFile   bool
+	Sub      bool
+}
+
+// BakupOptAddBatch records many backed up paths using a single database
+// connection and transaction. A non-empty tag is set on every entry.
+func BakupOptAddBatch(entries []BakupEntry, tag string, g GitCmd) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return err
+	}
+	db, err := NewSqldb(g.C)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	folders, _ := db_query_folders(tx)
+	for _, e := range entries {
+		destFile := e.DestFile.UnixStyle()
+		revcount := 1
+		if e.IsFile {
+			logs, err := repo.GitLogFile(destFile)
+			if err != nil {
+				return err
+			}
+			revcount = len(logs)
+		}
+		if err := db_add_opt(tx, e.SrcFile, destFile, e.IsFile, e.Sub, revcount, folders); err != nil {
+			return err
+		}
+		if !e.IsFile {
+			folders = append(folders, FileOperation{SrcFile: e.SrcFile, DestFile: destFile.Sting()})
+		}
+		if tag != "" {
+			if err := db_update_tag(tx, tag, destFile); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit file operations: %v", err)
+	}
+	return nil
+}
 
+// BakupOptRebuild replaces every file operation with ops in a single
+// transaction; the exclude rules are kept
+func BakupOptRebuild(ops []FileOperation, c *util.Config) error {
+	db, err := NewSqldb(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM file_operations`); err != nil {
+		return fmt.Errorf("failed to clear file operations: %v", err)
+	}
+	insertQuery := `
+	INSERT INTO file_operations (srcfile, destfile, isfile, revcount, sub, tag, add_time, update_time)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, op := range ops {
+		var tag sql.NullString
+		if op.Tag != "" {
+			tag = sql.NullString{String: op.Tag, Valid: true}
+		}
+		_, err := tx.Exec(insertQuery, op.SrcFile, op.DestFile, op.IsFile, op.RevCount, op.Sub, tag, op.AddTime.UTC(), op.UpdateTime.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert file operation: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit file operations: %v", err)
+	}
+	return nil
+}
+
+func db_add_opt(q sqlQuerier, srcFile string, destFile util.RepoPath, isFile bool, sub bool, revcount int, folders []FileOperation) error {
 	// Check if the entry already exists
 	checkQuery := `
 	SELECT COUNT(*) FROM file_operations
 	WHERE srcfile = ?`
 
 	var count int
-	err = db.db.QueryRow(checkQuery, srcFile).Scan(&count)
+	err := q.QueryRow(checkQuery, srcFile).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to check existing file operation: %v", err)
 	}
@@ -112,12 +229,12 @@ func BakupOptAdd(srcFile string, destFile util.RepoPath, isFile bool, sub bool,
 		SET  revcount = ?,  update_time = CURRENT_TIMESTAMP
 		WHERE srcfile = ?`
 
-		_, err = db.db.Exec(updateQuery, revcount, srcFile)
+		_, err = q.Exec(updateQuery, revcount, srcFile)
 		if err != nil {
 			return fmt.Errorf("failed to update file operation: %v", err)
 		}
 	} else {
-		if r, _ := GetRepoRoot(srcFile, g.C); r != nil {
+		if r := findRepoRoot(folders, srcFile); r != nil {
 			if isFile {
 				sub = true
 			}
@@ -127,7 +244,7 @@ func BakupOptAdd(srcFile string, destFile util.RepoPath, isFile bool, sub bool,
 		INSERT INTO file_operations (srcfile, destfile, isfile, revcount, sub, tag, add_time, update_time)
 		VALUES (?, ?, ?, ?, ?, NULL, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
 
-		_, err = db.db.Exec(insertQuery, srcFile, destFile, isFile, revcount, sub)
+		_, err = q.Exec(insertQuery, srcFile, destFile, isFile, revcount, sub)
 		if err != nil {
 			return fmt.Errorf("failed to insert file operation: %v", err)
 		}
@@ -147,7 +264,7 @@ func SetFileTag(repoPath util.RepoPath, tag string, c *util.Config) error {
 	defer db.Close()
 	if entry != nil {
 		if entry.Tag == tag {
-			return nil
+			return commitTag(tag, c, repoPath)
 		}
 		var filetoupdate []util.RepoPath = make([]util.RepoPath, 0)
 		if !entry.IsFile {
@@ -175,23 +292,37 @@ func SetFileTag(repoPath util.RepoPath, tag string, c *util.Config) error {
 			}
 		}
 		for _, f := range filetoupdate {
-			if err := db_update_tag(db, tag, f); err != nil {
+			if err := db_update_tag(db.db, tag, f); err != nil {
 				return fmt.Errorf("SetFlag %s not entry err=%v", tag, err)
 			}
 		}
 	}
 
 	// Update the tag for the specified file
-	return db_update_tag(db, tag, repoPath)
+	if err := db_update_tag(db.db, tag, repoPath); err != nil {
+		return err
+	}
+	return commitTag(tag, c, repoPath)
+}
+
+// commitTag records the tag of paths in the tag manifest of the repository,
+// see util.GitRepo.GitSetTag
+func commitTag(tag string, c *util.Config, paths ...util.RepoPath) error {
+	repo, err := util.NewGitReop(c)
+	if err != nil {
+		return err
+	}
+	_, err = repo.GitSetTag(tag, paths...)
+	return err
 }
 
-func db_update_tag(db *sqldb, tag string, repoPath util.RepoPath) error {
+func db_update_tag(db sqlQuerier, tag string, repoPath util.RepoPath) error {
 	updateQuery := `
 	UPDATE file_operations
 	SET tag = ?
 	WHERE destfile = ?`
 
-	result, err := db.db.Exec(updateQuery, tag, repoPath)
+	result, err := db.Exec(updateQuery, tag, repoPath)
 	if err != nil {
 		return fmt.Errorf("failed to update file tag: %v", err)
 	}
@@ -265,24 +396,33 @@ func GetRepoRoot(srcFile string, c *util.Config) (*FileOperation, error) {
 	if err != nil {
 		return nil, err
 	}
-	for _, op := range parent {
-		if rel, err := filepath.Rel(op.SrcFile, srcFile); err == nil {
-			fmt.Printf("rel == %v %v\n", rel, op.SrcFile)
-			return &op, nil
-		}
+	if op := findRepoRoot(parent, srcFile); op != nil {
+		return op, nil
 	}
 	return nil, fmt.Errorf("failed to get file operation: %v", err)
 }
+
+func findRepoRoot(folders []FileOperation, srcFile string) *FileOperation {
+	for _, op := range folders {
+		if isUnder(srcFile, op.SrcFile) {
+			return &op
+		}
+	}
+	return nil
+}
 func getFolderEntry(c *util.Config) ([]FileOperation, error) {
 	db, err := NewSqldb(c)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
+	return db_query_folders(db.db)
+}
 
+func db_query_folders(q sqlQuerier) ([]FileOperation, error) {
 	query := `SELECT id, srcfile, destfile, isfile, revcount, sub, tag, add_time, update_time FROM file_operations where isfile=false`
 
-	rows, err := db.db.Query(query)
+	rows, err := q.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query file operations: %v", err)
 	}
@@ -318,7 +458,7 @@ func BakupOptRm(file util.RepoPath, c *util.Config) error {
 	checkQuery := `SELECT COUNT(*) FROM file_operations WHERE destfile = ?`
 	if err := db.db.QueryRow(checkQuery, file).Scan(&count); err == nil {
 		if count == 0 {
-			fmt.Printf("File %s not found in database, no deletion needed", file)
+			logrus.Debugf("File %s not found in database, no deletion needed", file)
 			return nil
 		}
 	}
@@ -331,7 +471,7 @@ func BakupOptRm(file util.RepoPath, c *util.Config) error {
 	if err != nil {
 		return fmt.Errorf("sql failed to delete file operation:  %v", err)
 	} else {
-		fmt.Printf("SQL Deleted file operation for %s\n", file)
+		logrus.Debugf("SQL Deleted file operation for %s", file)
 	}
 	return nil
 }
@@ -404,3 +544,49 @@ func GetAllTags(c *util.Config) ([]string, error) {
 
 	return tags, nil
 }
+
+// SetDirExclude stores the exclude rules of a tracked directory, replacing
+// the rules stored before. No rules removes the entry.
+func SetDirExclude(destFile util.RepoPath, rules []string, c *util.Config) error {
+	db, err := NewSqldb(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	destFile = destFile.UnixStyle()
+	if len(rules) == 0 {
+		if _, err := db.db.Exec(`DELETE FROM excludes WHERE destfile = ?`, destFile); err != nil {
+			return fmt.Errorf("failed to delete excludes: %v", err)
+		}
+		return nil
+	}
+	query := `INSERT INTO excludes (destfile, rules) VALUES (?, ?)
+	ON CONFLICT(destfile) DO UPDATE SET rules = excluded.rules`
+	if _, err := db.db.Exec(query, destFile, strings.Join(rules, "\n")); err != nil {
+		return fmt.Errorf("failed to set excludes: %v", err)
+	}
+	return nil
+}
+
+// GetDirExcludes returns the exclude rules of every tracked directory
+func GetDirExcludes(c *util.Config) (map[util.RepoPath][]string, error) {
+	db, err := NewSqldb(c)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.db.Query(`SELECT destfile, rules FROM excludes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query excludes: %v", err)
+	}
+	defer rows.Close()
+	ret := map[util.RepoPath][]string{}
+	for rows.Next() {
+		var dest, rules string
+		if err := rows.Scan(&dest, &rules); err != nil {
+			return nil, fmt.Errorf("failed to scan excludes: %v", err)
+		}
+		ret[util.RepoPath(dest)] = strings.Split(rules, "\n")
+	}
+	return ret, rows.Err()
+}
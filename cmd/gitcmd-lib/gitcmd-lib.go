@@ -38,11 +38,18 @@ typedef struct {
 	char** tags;
 	int count;
 } TagArray;
+
+// LogCallback receives the logrus level (0 panic .. 6 trace) and the message.
+// The message is freed after the callback returns.
+typedef void (*LogCallback)(int level, const char* msg);
+
+static inline void callLogCallback(LogCallback cb, int level, const char* msg) {
+	cb(level, msg);
+}
 */
 import "C"
 
 import (
-	"fmt"
 	"unsafe"
 
 	"anybakup/cmd"
@@ -52,6 +59,16 @@ import (
 	// "fmt"
 )
 
+// loadGitCmd opens a profile, logging an unknown one and returning nil
+func loadGitCmd(profilename *C.char) *cmd.GitCmd {
+	g, err := cmd.LoadGitCmd(C.GoString(profilename))
+	if err != nil {
+		logrus.Errorf("%v", err)
+		return nil
+	}
+	return g
+}
+
 // C-exportable wrapper for GetFileLog
 //
 //export GetFileLogC
@@ -59,9 +76,11 @@ func GetFileLogC(profilename *C.char, filePath *C.char) *C.GitChangeArray {
 	if filePath == nil {
 		return nil
 	}
-	goProfilename := C.GoString(profilename)
 	goFilePath := C.GoString(filePath)
-	g := cmd.NewGitCmd(goProfilename)
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return nil
+	}
 	logs, err := g.GetFileLog(util.RepoPath(goFilePath))
 	if err != nil {
 		return nil
@@ -164,7 +183,10 @@ func GetFileLogC(profilename *C.char, filePath *C.char) *C.GitChangeArray {
 //
 //export GetAllOptC
 func GetAllOptC(profilename *C.char) *C.FileOperationArray {
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return nil
+	}
 	operations, err := cmd.GetAllOpt(g.C)
 	if err != nil {
 		return nil
@@ -251,13 +273,16 @@ func RmFileC(profilename *C.char, filePath *C.char) C.int {
 		return -1
 	}
 	goFilePath := C.GoString(filePath)
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return -2
+	}
 	err := g.RmFile(util.RepoPath(goFilePath))
 	if err != nil {
-		fmt.Printf("RmFileC failed %v err=%v", goFilePath, err)
+		logrus.Errorf("RmFileC failed %v err=%v", goFilePath, err)
 		return -2
 	}
-	fmt.Printf("RmFileC success %v", goFilePath)
+	logrus.Infof("RmFileC success %v", goFilePath)
 	return 0
 }
 
@@ -269,7 +294,10 @@ func AddFileC(profilename *C.char, filePath *C.char) C.int {
 		return 3
 	}
 	goFilePath := C.GoString(filePath)
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return 2
+	}
 	result := g.AddFile(goFilePath)
 	if result.Err != nil {
 		return 2
@@ -289,7 +317,10 @@ func AddFileCWithTag(profilename *C.char, filePath *C.char, tag *C.char) C.int {
 	}
 	goFilePath := C.GoString(filePath)
 	goTag := C.GoString(tag)
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return 2
+	}
 	result := g.AddFile(goFilePath,goTag)
 	if result.Err != nil {
 		return 2
@@ -326,7 +357,10 @@ func GetFileC(profilename *C.char, filePath *C.char, commit *C.char, target *C.c
 	goFilePath := C.GoString(filePath)
 	goCommit := C.GoString(commit)
 	goTarget := C.GoString(target)
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return -2
+	}
 	err := g.GetFile(util.RepoPath(goFilePath), goCommit, goTarget)
 	if err != nil {
 		return -2
@@ -334,6 +368,41 @@ func GetFileC(profilename *C.char, filePath *C.char, commit *C.char, target *C.c
 	return 0
 }
 
+// SetLogCallbackC sends all log messages to cb instead of stderr.
+// A NULL cb restores logging to stderr.
+//
+//export SetLogCallbackC
+func SetLogCallbackC(cb C.LogCallback) {
+	if cb == nil {
+		util.SetLogCallback(nil)
+		return
+	}
+	util.SetLogCallback(func(level logrus.Level, msg string) {
+		cmsg := C.CString(msg)
+		defer C.free(unsafe.Pointer(cmsg))
+		C.callLogCallback(cb, C.int(level), cmsg)
+	})
+}
+
+// SetConfigFileC makes the library use the config file at path instead of
+// the default lookup. An empty path restores the default.
+//
+//export SetConfigFileC
+func SetConfigFileC(path *C.char) {
+	util.SetConfigFile(C.GoString(path))
+}
+
+// SetLogLevelC sets the log level: trace, debug, info, warn or error
+//
+//export SetLogLevelC
+func SetLogLevelC(level *C.char) C.int {
+	if err := util.SetLogLevel(C.GoString(level)); err != nil {
+		logrus.Errorf("SetLogLevelC failed err=%v", err)
+		return -1
+	}
+	return 0
+}
+
 // Helper function to free C strings
 //
 //export FreeString
@@ -421,7 +490,10 @@ func SetFileTagC(profilename *C.char, filePath *C.char, tag *C.char) C.int {
 	}
 	goFilePath := C.GoString(filePath)
 	goTag := C.GoString(tag)
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return -2
+	}
 
 	err := cmd.SetFileTag(util.RepoPath(goFilePath), goTag, g.C)
 	if err != nil {
@@ -440,14 +512,17 @@ func GetFileTagC(profilename *C.char, filePath *C.char) *C.char {
 		return nil
 	}
 	goFilePath := C.GoString(filePath)
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return nil
+	}
 
 	tag, err := cmd.GetFileTag(util.RepoPath(goFilePath), g.C)
 	if err != nil {
-		fmt.Printf("GetFileTagC failed %v err=%v", goFilePath, err)
+		logrus.Errorf("GetFileTagC failed %v err=%v", goFilePath, err)
 		return nil
 	}
-	fmt.Printf("GetFileTagC success %v tag=%v", goFilePath, tag)
+	logrus.Debugf("GetFileTagC success %v tag=%v", goFilePath, tag)
 	return C.CString(tag)
 }
 
@@ -455,11 +530,14 @@ func GetFileTagC(profilename *C.char, filePath *C.char) *C.char {
 //
 //export GetAllTagsC
 func GetAllTagsC(profilename *C.char) *C.TagArray {
-	g := cmd.NewGitCmd(C.GoString(profilename))
+	g := loadGitCmd(profilename)
+	if g == nil {
+		return nil
+	}
 
 	tags, err := cmd.GetAllTags(g.C)
 	if err != nil {
-		fmt.Printf("GetAllTagsC failed err=%v", err)
+		logrus.Errorf("GetAllTagsC failed err=%v", err)
 		return nil
 	}
 
@@ -1,29 +1,56 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"anybakup/util"
+
+	"github.com/sirupsen/logrus"
 )
 
 type GitCmd struct {
 	C *util.Config
 }
 
+// NewGitCmd is LoadGitCmd falling back to the top-level config with an
+// error logged when the profile does not exist
 func NewGitCmd(profilname string) *GitCmd {
+	g, err := LoadGitCmd(profilname)
+	if err != nil {
+		logrus.Errorf("%v, using %v", err, g.C.RepoDir)
+	}
+	return g
+}
+
+// LoadGitCmd opens a profile. An empty name selects the "default" profile
+// or, when there is none, the top-level config; any other name must exist.
+func LoadGitCmd(profilname string) (*GitCmd, error) {
 	c := util.Config{}
 	if err := c.Load(); err != nil {
-		fmt.Printf("error loading config\n: %v", err)
+		return &GitCmd{C: &c}, fmt.Errorf("error loading config: %v", err)
 	}
+	return GitCmdFor(&c, profilname)
+}
+
+// GitCmdFor is LoadGitCmd for a config loaded by the caller, e.g. with
+// util.LoadConfig
+func GitCmdFor(c *util.Config, profilname string) (*GitCmd, error) {
 	if config := c.GetProfile(profilname); config != nil {
 		return &GitCmd{
 			C: config,
-		}
-	} else {
-		return &GitCmd{C: &c}
+		}, nil
 	}
+	if profilname != "" {
+		return &GitCmd{C: c}, fmt.Errorf("unknown profile %q", profilname)
+	}
+	return &GitCmd{C: c}, nil
 }
 
 // GetFileLogAbs returns the git log for a specific file
@@ -51,86 +78,544 @@ func (g GitCmd) GetFileLog(filePath util.RepoPath) ([]util.GitChanges, error) {
 	return logs, nil
 }
 
+// GetPathLogAbs returns the git log for a file or a directory
+func (g GitCmd) GetPathLogAbs(filePath string) ([]util.GitChanges, error) {
+	absFilePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GitLogPath(repo.Src2Repo(absFilePath))
+}
+
 type Result_git_add struct {
-	Dest   util.RepoPath
-	Err    error
-	Result util.GitAction
-	Files  []util.RepoPath
+	Src    string          `json:"src"`
+	Dest   util.RepoPath   `json:"dest"`
+	Err    error           `json:"-"`
+	Result util.GitAction  `json:"result"`
+	Files  []util.RepoPath `json:"files"`
+	// Excluded lists files still in the backup that match an exclude rule
+	Excluded []util.RepoPath `json:"excluded,omitempty"`
+	// Deleted lists files removed from the backup in mirror mode
+	Deleted []util.RepoPath `json:"deleted,omitempty"`
+}
+
+// MarshalJSON renders Err as its message
+func (r Result_git_add) MarshalJSON() ([]byte, error) {
+	type result Result_git_add
+	ret := struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result: result(r)}
+	if r.Err != nil {
+		ret.Error = r.Err.Error()
+	}
+	return json.Marshal(ret)
+}
+
+// openRepo opens the repository with the exclude rules of the profile and
+// of every tracked directory. Rules in override replace the stored rules of
+// their directory.
+func (g GitCmd) openRepo(override ...map[util.RepoPath][]string) (*util.GitRepo, error) {
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := GetDirExcludes(g.C)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range override {
+		maps.Copy(excludes, o)
+	}
+	for dir, rules := range excludes {
+		repo.Excludes.Add(dir, rules...)
+	}
+	return repo, nil
+}
+
+// AddFile adds a file or directory to the git repository, see AddFilesWith
+func (g GitCmd) AddFile(arg string, tag ...string) Result_git_add {
+	ret := g.AddFilesWith([]string{arg}, AddOptions{}, tag...)
+	// a pattern may match many paths, report the first failure
+	for _, r := range ret {
+		if r.Err != nil {
+			return r
+		}
+	}
+	return ret[0]
+}
+
+// ExpandPaths expands shell-style glob patterns into absolute paths; plain
+// paths are kept as given. A pattern without matches is an error.
+func ExpandPaths(arg string) ([]string, error) {
+	matches := []string{arg}
+	if strings.ContainsAny(arg, "*?[") {
+		var err error
+		if matches, err = filepath.Glob(arg); err != nil {
+			return nil, fmt.Errorf("bad pattern %v: %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no match for %v", arg)
+		}
+	}
+	ret := []string{}
+	for _, m := range matches {
+		abs, err := filepath.Abs(m)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, abs)
+	}
+	return ret, nil
 }
 
-// AddFile adds a file to the git repository
-func (g GitCmd) AddFile(arg string, tag ...string) (ret Result_git_add) {
+// AddFiles copies many files or directories into the repository and commits
+// them as a single snapshot. Each argument may be a shell-style glob pattern.
+// One result is returned per matched path.
+func (g GitCmd) AddFiles(args []string, tag ...string) (ret []Result_git_add) {
+	return g.AddFilesWith(args, AddOptions{}, tag...)
+}
+
+// AddOptions tunes AddFilesWith
+type AddOptions struct {
+	// Exclude holds gitignore-style rules stored for every directory added.
+	// They replace the rules given for the directory before and are
+	// honoured by later adds, sync and watch.
+	Exclude []string
+	// Mirror removes files from the backup of a directory that no longer
+	// exist at the source, see util.GitRepo.MirrorDeletes
+	Mirror bool
+}
+
+// AddFilesWith is AddFiles with options
+func (g GitCmd) AddFilesWith(args []string, opt AddOptions, tag ...string) (ret []Result_git_add) {
 	gitag := ""
 	if len(tag) > 0 {
 		gitag = tag[0]
 	}
-	file, err := filepath.Abs(arg)
-	if err != nil {
-		ret.Err = err
-		return
+	files := []string{}
+	for _, arg := range args {
+		matches, err := ExpandPaths(arg)
+		if err != nil {
+			ret = append(ret, Result_git_add{Src: arg, Err: err, Result: util.GitResultTypeError})
+			continue
+		}
+		for _, m := range matches {
+			if !slices.Contains(files, m) {
+				files = append(files, m)
+			}
+		}
 	}
-	ret = Result_git_add{
-		Dest:   "",
-		Err:    nil,
-		Result: util.GitResultTypeError,
+	// the rules apply to this add and are stored once it succeeded
+	excludes := map[util.RepoPath][]string{}
+	if len(opt.Exclude) > 0 {
+		for _, file := range files {
+			if isDirPath(file) {
+				excludes[util.SrcPath(file).Repo().UnixStyle()] = opt.Exclude
+			}
+		}
 	}
-	repo, err := util.NewGitReop(g.C)
+	repo, err := g.openRepo(excludes)
 	if err != nil {
-		ret.Err = err
-		return
+		return append(ret, Result_git_add{Err: err, Result: util.GitResultTypeError})
 	}
-	dest, err := repo.CopyToRepo(util.SrcPath(file))
+	copied := []Result_git_add{}
+	srcs := []string{}
+	dests := []util.RepoPath{}
+	for _, file := range files {
+		if repo.Excludes.Match(util.SrcPath(file).Repo(), isDirPath(file)) {
+			ret = append(ret, Result_git_add{Src: file, Err: fmt.Errorf("%v is excluded", file), Result: util.GitResultTypeError})
+			continue
+		}
+		dest, err := repo.CopyToRepo(util.SrcPath(file))
+		if err == nil && opt.Mirror {
+			_, err = repo.MirrorDeletes(util.SrcPath(file))
+		}
+		if err != nil {
+			ret = append(ret, Result_git_add{Src: file, Err: err, Result: util.GitResultTypeError})
+			continue
+		}
+		srcs = append(srcs, file)
+		dests = append(dests, dest)
+		copied = append(copied, Result_git_add{Src: file, Dest: dest.UnixStyle(), Result: util.GitResultTypeNochange})
+	}
+	yes, err := repo.GitAddFiles(dests, opt.Mirror, gitag)
 	if err != nil {
-		ret.Err = err
-		return
+		for i := range copied {
+			copied[i].Err = err
+			copied[i].Result = util.GitResultTypeError
+		}
+		return append(ret, copied...)
 	}
-	if yes, err := repo.GitAddFile(dest); err != nil {
-		ret.Err = err
-	} else {
-		ret.Result = yes.Action
-		fmt.Printf(">>> result %v\n", ret.Result)
-		switch yes.Action {
-		case util.GitResultTypeAdd:
-			ret.Dest = dest
-		case util.GitResultTypeNochange:
-			ret.Dest = dest
-		default:
-			ret.Err = fmt.Errorf("add unexpected result %v", yes)
-			return
+	entries := []BakupEntry{}
+	for i := range copied {
+		r := &copied[i]
+		if rules, ok := excludes[r.Dest]; ok {
+			if err := SetDirExclude(r.Dest, rules, g.C); err != nil {
+				r.Err = err
+			}
 		}
-		isfile, err := IsFile(file)
-		fmt.Printf("isfile %v %v\n", isfile, err)
-		if err != nil {
-			ret.Err = err
-			return
+		for _, f := range yes.Files {
+			if f == r.Dest || strings.HasPrefix(f.Sting(), r.Dest.Sting()+"/") {
+				r.Files = append(r.Files, f)
+				r.Result = util.GitResultTypeAdd
+			}
 		}
-		if err := BakupOptAdd(file, ret.Dest, isfile, false, g); err != nil {
-			fmt.Printf("failed to add sql backup record %v", err)
+		for _, f := range yes.Deleted {
+			if strings.HasPrefix(f.Sting(), r.Dest.Sting()+"/") {
+				r.Deleted = append(r.Deleted, f)
+				r.Result = util.GitResultTypeAdd
+				if err := BakupOptRm(f, g.C); err != nil {
+					logrus.Warnf("%v %v", err, f)
+				}
+			}
 		}
-		if gitag != "" {
-			SetFileTag(ret.Dest, gitag, g.C)
+		isfile, err := IsFile(srcs[i])
+		if err != nil {
+			r.Err = err
+			continue
 		}
+		entries = append(entries, BakupEntry{SrcFile: srcs[i], DestFile: r.Dest, IsFile: isfile})
+		r.Excluded, _ = repo.GitExcluded(r.Dest)
 		if !isfile {
-			for _, f := range yes.Files {
-				ret.Files = append(ret.Files, f)
+			for _, f := range r.Files {
 				src, err := f.ToSrc()
 				if err != nil {
-					fmt.Printf("failed to add sql backup record %v", err)
-				}
-				if err := BakupOptAdd(src.String(), f, true, true, g); err != nil {
-					fmt.Printf("failed to add sql backup record %v", err)
-				} else {
-					if gitag != "" {
-						SetFileTag(f, gitag, g.C)
-					}
-					fmt.Printf(">>> added to sql %v\n", f)
+					logrus.Warnf("failed to add sql backup record %v", err)
+					continue
 				}
+				entries = append(entries, BakupEntry{SrcFile: src.String(), DestFile: f, IsFile: true, Sub: true})
+			}
+		}
+	}
+	if err := BakupOptAddBatch(entries, gitag, g); err != nil {
+		logrus.Warnf("failed to add sql backup record %v", err)
+	}
+	unchanged := []util.RepoPath{}
+	for _, r := range copied {
+		if r.Result == util.GitResultTypeNochange {
+			unchanged = append(unchanged, r.Dest)
+		}
+	}
+	if gitag != "" && len(unchanged) > 0 {
+		// unchanged paths were not committed with the tag
+		if err := commitTag(gitag, g.C, unchanged...); err != nil {
+			logrus.Warnf("failed to record tag %v", err)
+		}
+	}
+	return append(ret, copied...)
+}
+
+type SyncState string
+
+const (
+	SyncAdded     SyncState = "added"
+	SyncUpdated   SyncState = "updated"
+	SyncUnchanged SyncState = "unchanged"
+	SyncMissing   SyncState = "missing"
+	SyncDeleted   SyncState = "deleted"
+	SyncError     SyncState = "error"
+)
+
+// SyncEntry is the outcome of Sync for one tracked file
+type SyncEntry struct {
+	Src   string        `json:"src"`
+	Dest  util.RepoPath `json:"dest"`
+	State SyncState     `json:"state"`
+	// Err says why a path in state error could not be backed up
+	Err string `json:"error,omitempty"`
+}
+
+// isUnder reports whether path is below dir
+func isUnder(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// isCovered reports whether src lies inside one of the tracked directories
+func isCovered(ops []FileOperation, src string) bool {
+	return slices.ContainsFunc(ops, func(dir FileOperation) bool {
+		return !dir.IsFile && isUnder(src, dir.SrcFile)
+	})
+}
+
+// Sync re-copies every tracked source (optionally only those with tag) and
+// commits all changes as a single snapshot. Files inside tracked directories
+// are covered by copying the directory. With mirror, files deleted below a
+// tracked directory are deleted from the backup too; a tracked path that is
+// missing itself is never deleted.
+func (g GitCmd) Sync(tag string, mirror bool) ([]SyncEntry, error) {
+	ops, err := GetAllOpt(g.C)
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" {
+		ops = slices.DeleteFunc(ops, func(op FileOperation) bool { return op.Tag != tag })
+	}
+	repo, err := g.openRepo()
+	if err != nil {
+		return nil, err
+	}
+	ret := []SyncEntry{}
+	tracked := map[util.RepoPath]bool{}
+	dests := []util.RepoPath{}
+	failed := []string{}
+	for _, op := range ops {
+		tracked[util.RepoPath(op.DestFile)] = true
+		if _, err := os.Lstat(op.SrcFile); err != nil {
+			ret = append(ret, SyncEntry{Src: op.SrcFile, Dest: util.RepoPath(op.DestFile), State: SyncMissing})
+			continue
+		}
+		if isCovered(ops, op.SrcFile) {
+			continue
+		}
+		// a failing path is reported and the others are still committed
+		dest, err := repo.CopyToRepo(util.SrcPath(op.SrcFile))
+		if err != nil {
+			failed = append(failed, op.SrcFile)
+			ret = append(ret, SyncEntry{Src: op.SrcFile, Dest: util.RepoPath(op.DestFile), State: SyncError, Err: err.Error()})
+			continue
+		}
+		dests = append(dests, dest)
+		if mirror {
+			if _, err := repo.MirrorDeletes(util.SrcPath(op.SrcFile)); err != nil {
+				ret = append(ret, SyncEntry{Src: op.SrcFile, Dest: dest, State: SyncError, Err: err.Error()})
+			}
+		}
+	}
+	yes, err := repo.GitAddFiles(dests, mirror, tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range yes.Deleted {
+		i := slices.IndexFunc(ret, func(e SyncEntry) bool { return e.Dest == f })
+		if i < 0 {
+			src, _ := f.PlatformStyle().ToSrc()
+			ret = append(ret, SyncEntry{Src: src.String(), Dest: f})
+			i = len(ret) - 1
+		}
+		ret[i].State = SyncDeleted
+		if err := BakupOptRm(f, g.C); err != nil {
+			logrus.Warnf("%v %v", err, f)
+		}
+	}
+	entries := []BakupEntry{}
+	for _, f := range yes.Files {
+		src, err := f.ToSrc()
+		if err != nil {
+			return nil, err
+		}
+		state := SyncUpdated
+		if !tracked[f] {
+			state = SyncAdded
+		}
+		ret = append(ret, SyncEntry{Src: src.String(), Dest: f, State: state})
+		entries = append(entries, BakupEntry{SrcFile: src.String(), DestFile: f, IsFile: true, Sub: !slices.Contains(dests, f)})
+	}
+	for _, op := range ops {
+		dest := util.RepoPath(op.DestFile)
+		if !op.IsFile || slices.Contains(yes.Files, dest) {
+			continue
+		}
+		if slices.ContainsFunc(failed, func(dir string) bool { return isUnder(op.SrcFile, dir) }) {
+			continue
+		}
+		if !slices.ContainsFunc(ret, func(e SyncEntry) bool { return e.Dest == dest }) {
+			ret = append(ret, SyncEntry{Src: op.SrcFile, Dest: dest, State: SyncUnchanged})
+		}
+	}
+	if err := BakupOptAddBatch(entries, tag, g); err != nil {
+		return ret, err
+	}
+	slices.SortFunc(ret, func(a, b SyncEntry) int { return strings.Compare(a.Src, b.Src) })
+	return ret, nil
+}
+
+type TrackState string
+
+const (
+	StateTracked   TrackState = "tracked"
+	StateModified  TrackState = "modified"
+	StateMissing   TrackState = "missing"
+	StateUntracked TrackState = "untracked"
+)
+
+// FileStatus is the backup state of one path
+type FileStatus struct {
+	Src        string        `json:"src"`
+	Dest       util.RepoPath `json:"dest"`
+	State      TrackState    `json:"state"`
+	IsFile     bool          `json:"isfile"`
+	Tag        string        `json:"tag"`
+	RevCount   int           `json:"revcount"`
+	LastBackup time.Time     `json:"last_backup"` // zero if untracked
+}
+
+// sourceState compares a tracked source with its last backup
+func sourceState(repo *util.GitRepo, src string) (TrackState, error) {
+	if _, err := os.Lstat(src); err != nil {
+		return StateMissing, nil
+	}
+	modified, err := repo.GitSrcModified(util.SrcPath(src))
+	if err != nil {
+		return "", err
+	}
+	if modified {
+		return StateModified, nil
+	}
+	return StateTracked, nil
+}
+
+// ListEntry is one tracked entry reported by List
+type ListEntry struct {
+	SrcFile    string     `json:"srcfile"`
+	DestFile   string     `json:"destfile"`
+	IsFile     bool       `json:"isfile"`
+	RevCount   int        `json:"revcount"`
+	Tag        string     `json:"tag"`
+	AddTime    time.Time  `json:"add_time"`
+	UpdateTime time.Time  `json:"update_time"`
+	Status     TrackState `json:"status"`
+}
+
+// ListOptions filters and sorts List
+type ListOptions struct {
+	Tag          string
+	DirOnly      bool
+	FileOnly     bool
+	ChangedSince time.Time // only entries backed up at or after this time
+	// Sort is one of src (default), dest, revcount, tag, added or updated
+	Sort    string
+	Reverse bool
+}
+
+// ListSortKeys are the values accepted for ListOptions.Sort
+var ListSortKeys = []string{"src", "dest", "revcount", "tag", "added", "updated"}
+
+// List returns the tracked entries matching opt with their on-disk status
+func (g GitCmd) List(opt ListOptions) ([]ListEntry, error) {
+	if opt.Sort != "" && !slices.Contains(ListSortKeys, opt.Sort) {
+		return nil, fmt.Errorf("unknown sort key %q, use one of %v", opt.Sort, strings.Join(ListSortKeys, ", "))
+	}
+	ops, err := GetAllOpt(g.C)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := g.openRepo()
+	if err != nil {
+		return nil, err
+	}
+	ret := []ListEntry{}
+	for _, op := range ops {
+		if (opt.Tag != "" && op.Tag != opt.Tag) || (opt.DirOnly && op.IsFile) || (opt.FileOnly && !op.IsFile) {
+			continue
+		}
+		if !opt.ChangedSince.IsZero() && op.UpdateTime.Before(opt.ChangedSince) {
+			continue
+		}
+		state, err := sourceState(repo, op.SrcFile)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ListEntry{
+			SrcFile:    op.SrcFile,
+			DestFile:   op.DestFile,
+			IsFile:     op.IsFile,
+			RevCount:   op.RevCount,
+			Tag:        op.Tag,
+			AddTime:    op.AddTime,
+			UpdateTime: op.UpdateTime,
+			Status:     state,
+		})
+	}
+	slices.SortStableFunc(ret, func(a, b ListEntry) int {
+		c := 0
+		switch opt.Sort {
+		case "dest":
+			c = strings.Compare(a.DestFile, b.DestFile)
+		case "revcount":
+			c = a.RevCount - b.RevCount
+		case "tag":
+			c = strings.Compare(a.Tag, b.Tag)
+		case "added":
+			c = a.AddTime.Compare(b.AddTime)
+		case "updated":
+			c = a.UpdateTime.Compare(b.UpdateTime)
+		}
+		if c == 0 {
+			c = strings.Compare(a.SrcFile, b.SrcFile)
+		}
+		if opt.Reverse {
+			return -c
+		}
+		return c
+	})
+	return ret, nil
+}
+
+// Status compares the given paths, or every tracked entry if none are
+// given, with their last backup. Paths unknown to the operation log are
+// untracked.
+func (g GitCmd) Status(args ...string) ([]FileStatus, error) {
+	repo, err := g.openRepo()
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		op      FileOperation
+		tracked bool
+	}
+	entries := []entry{}
+	if len(args) == 0 {
+		ops, err := GetAllOpt(g.C)
+		if err != nil {
+			return nil, err
+		}
+		slices.SortFunc(ops, func(a, b FileOperation) int { return strings.Compare(a.SrcFile, b.SrcFile) })
+		for _, op := range ops {
+			entries = append(entries, entry{op, true})
+		}
+	} else {
+		for _, arg := range args {
+			file, err := filepath.Abs(arg)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			ret.Files = append(ret.Files, ret.Dest)
+			dest := util.SrcPath(file).Repo().UnixStyle()
+			op, err := GetFile(dest, g.C)
+			if err != nil {
+				return nil, err
+			}
+			if op == nil {
+				entries = append(entries, entry{FileOperation{SrcFile: file, DestFile: dest.Sting(), IsFile: !isDirPath(file)}, false})
+			} else {
+				entries = append(entries, entry{*op, true})
+			}
+		}
+	}
+	ret := []FileStatus{}
+	for _, e := range entries {
+		op := e.op
+		st := FileStatus{
+			Src:        op.SrcFile,
+			Dest:       util.RepoPath(op.DestFile),
+			IsFile:     op.IsFile,
+			Tag:        op.Tag,
+			RevCount:   op.RevCount,
+			LastBackup: op.UpdateTime,
+			State:      StateTracked,
 		}
+		if !e.tracked {
+			st.State = StateUntracked
+		} else if st.State, err = sourceState(repo, op.SrcFile); err != nil {
+			return ret, err
+		}
+		ret = append(ret, st)
 	}
-	return
+	return ret, nil
 }
 
 // RmFileAbs removes a file from the git repository using an absolute path
@@ -149,12 +634,18 @@ func (g GitCmd) RmFileAbs(arg string) error {
 
 // RmFile removes a file from the git repository using a repository path
 func (g GitCmd) RmFile(gitPath util.RepoPath) error {
+	_, err := g.RmFileResult(gitPath)
+	return err
+}
+
+// RmFileResult is RmFile returning the removed files
+func (g GitCmd) RmFileResult(gitPath util.RepoPath) (util.GitResult, error) {
 	repo, err := util.NewGitReop(g.C)
 	if err != nil {
-		return err
+		return util.GitResult{Action: util.GitResultTypeError}, err
 	}
 	if yes, err := repo.GitRmFile(gitPath); err != nil {
-		return err
+		return yes, err
 	} else {
 		switch yes.Action {
 		case util.GitResultTypeRm:
@@ -162,25 +653,30 @@ func (g GitCmd) RmFile(gitPath util.RepoPath) error {
 		case util.GitResultTypeNochange:
 			break
 		default:
-			return fmt.Errorf("rm unexpected result %v", yes)
+			return yes, fmt.Errorf("rm unexpected result %v", yes)
 		}
 		if err := BakupOptRm(gitPath, g.C); err != nil {
-			fmt.Println(err, gitPath)
+			logrus.Warnf("%v %v", err, gitPath)
 		}
 		for _, v := range yes.Files {
 			if err := BakupOptRm(v, g.C); err != nil {
-				fmt.Println(err, v)
+				logrus.Warnf("%v %v", err, v)
 			}
 		}
 		for _, v := range yes.Dirs {
 			if err := BakupOptRm(v, g.C); err != nil {
-				fmt.Println(err, v)
+				logrus.Warnf("%v %v", err, v)
 			}
 		}
-		return nil
+		return yes, nil
 	}
 }
 
+func isDirPath(file string) bool {
+	st, err := os.Stat(file)
+	return err == nil && st.IsDir()
+}
+
 func IsFile(file string) (bool, error) {
 	if st, err := os.Stat(file); err != nil {
 		return true, err
@@ -189,30 +685,243 @@ func IsFile(file string) (bool, error) {
 	}
 }
 
-// GetFile retrieves a file from a specific commit
+// GetFile retrieves a file or a whole directory from a specific commit.
+// An empty commit means HEAD.
 func (g GitCmd) GetFile(filePath util.RepoPath, commit string, target string) error {
-	var err error
+	_, err := g.ExportFile(filePath, commit, target)
+	return err
+}
+
+// ExportFile is GetFile returning the written files
+func (g GitCmd) ExportFile(filePath util.RepoPath, commit string, target string) ([]util.RestoreEntry, error) {
 	repo, err := util.NewGitReop(g.C)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return repo.GitExportTree(filePath, commit, target)
+}
 
-	// If commit is empty, use HEAD
-	if commit == "" {
-		r, err := repo.Open()
-		if err != nil {
-			return fmt.Errorf("failed to open repo: %v", err)
+// DiffFile compares versions of a source file.
+// With no commit the repo copy is compared with the live file, with one commit
+// that commit's version is compared with the live file, and with two commits
+// the two historical versions are compared.
+func (g GitCmd) DiffFile(arg string, contextLines int, commits ...string) (string, error) {
+	file, err := filepath.Abs(arg)
+	if err != nil {
+		return "", err
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return "", err
+	}
+	switch len(commits) {
+	case 0:
+		return repo.GitDiffSrc(util.SrcPath(file), "", contextLines)
+	case 1:
+		return repo.GitDiffSrc(util.SrcPath(file), commits[0], contextLines)
+	default:
+		return repo.GitDiffCommits(repo.Src2Repo(file), commits[0], commits[1], contextLines)
+	}
+}
+
+// DriftFile compares the live file or directory with its last backup
+// without copying anything into the repository
+func (g GitCmd) DriftFile(arg string, contextLines int) (string, error) {
+	file, err := filepath.Abs(arg)
+	if err != nil {
+		return "", err
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return "", err
+	}
+	return repo.GitDriftSrc(util.SrcPath(file), contextLines)
+}
+
+// ResolveAt resolves an --at value for a repo path. A revision of the
+// repository is used as is, anything else must be a timestamp and selects
+// the newest commit touching the path at or before it. An empty value means
+// HEAD.
+func (g GitCmd) ResolveAt(gitPath util.RepoPath, at string) (string, error) {
+	if at == "" {
+		return "", nil
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return "", err
+	}
+	if _, err := repo.GitResolveRevision(at); err == nil {
+		return at, nil
+	}
+	t, err := util.ParseAt(at)
+	if err != nil {
+		return "", err
+	}
+	return repo.GitCommitAt(gitPath, t)
+}
+
+// Restore writes a backed up file or directory back to its original location
+func (g GitCmd) Restore(arg string, at string, dryRun bool) ([]util.RestoreEntry, error) {
+	file, err := filepath.Abs(arg)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return nil, err
+	}
+	gitPath := repo.Src2Repo(file)
+	commit, err := g.ResolveAt(gitPath, at)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GitRestore(gitPath, commit, dryRun)
+}
+
+// Push pushes the repository to the named remotes of the profile, or to all
+// of them, and returns the remotes pushed to
+func (g GitCmd) Push(names ...string) ([]string, error) {
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(g.C.Remotes))
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no remotes configured, add one with anybakup remote add")
+	}
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return nil, err
+	}
+	pushed := []string{}
+	for _, name := range names {
+		remote, ok := g.C.Remotes[name]
+		if !ok {
+			return pushed, fmt.Errorf("unknown remote %q", name)
+		}
+		if err := repo.GitPush(name, remote.URL); err != nil {
+			return pushed, err
+		}
+		pushed = append(pushed, name)
+	}
+	return pushed, nil
+}
+
+// RebuildIndex recreates the file operations of file_operations.db from the
+// repository. The tracked paths and their tags come from the commit
+// messages, the files from the HEAD tree, the sources from RepoPath.ToSrc and
+// the revision counts and times from the commits changing each path. Tags
+// already in the database win over the committed tag manifest, which wins
+// over the tags of the commit messages. Files no tracked path covers are
+// recorded as tracked files.
+func (g GitCmd) RebuildIndex() ([]FileOperation, error) {
+	repo, err := util.NewGitReop(g.C)
+	if err != nil {
+		return nil, err
+	}
+	tracked, err := repo.GitTrackedPaths()
+	if err != nil {
+		return nil, err
+	}
+	files, err := repo.GitHeadFiles()
+	if err != nil {
+		return nil, err
+	}
+	history, err := repo.GitPathHistory()
+	if err != nil {
+		return nil, err
+	}
+	committed, err := repo.GitTags("")
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	if old, err := GetAllOpt(g.C); err != nil {
+		logrus.Warnf("tags of the old index are lost: %v", err)
+	} else {
+		for _, op := range old {
+			tags[op.DestFile] = op.Tag
+		}
+	}
+	now := time.Now()
+	ops := []FileOperation{}
+	seen := map[util.RepoPath]bool{}
+	add := func(dest util.RepoPath, isfile, sub bool, tag string) error {
+		if seen[dest] {
+			return nil
 		}
-		ref, err := r.Head()
+		seen[dest] = true
+		src, err := dest.PlatformStyle().ToSrc()
 		if err != nil {
-			return fmt.Errorf("failed to get HEAD: %v", err)
+			return err
+		}
+		op := FileOperation{SrcFile: src.String(), DestFile: dest.Sting(), IsFile: isfile,
+			RevCount: 1, Sub: sub, Tag: tag, AddTime: now, UpdateTime: now}
+		if t := committed.Of(dest); t != "" {
+			op.Tag = t
+		}
+		if t := tags[dest.Sting()]; t != "" {
+			op.Tag = t
+		}
+		if h, ok := history[dest]; isfile && ok {
+			op.RevCount, op.AddTime, op.UpdateTime = h.Revs, h.First, h.Last
+		}
+		if !isfile {
+			// a directory spans the history of every path below it
+			first := true
+			for path, h := range history {
+				if !strings.HasPrefix(path.Sting(), dest.Sting()+"/") {
+					continue
+				}
+				if first || h.First.Before(op.AddTime) {
+					op.AddTime = h.First
+				}
+				if first || h.Last.After(op.UpdateTime) {
+					op.UpdateTime = h.Last
+				}
+				first = false
+			}
+		}
+		ops = append(ops, op)
+		return nil
+	}
+	for _, t := range tracked {
+		if slices.Contains(files, t.Path) {
+			if err := add(t.Path, true, false, t.Tag); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		under := slices.DeleteFunc(slices.Clone(files), func(f util.RepoPath) bool {
+			return !strings.HasPrefix(f.Sting(), t.Path.Sting()+"/")
+		})
+		if len(under) == 0 {
+			// removed since
+			continue
+		}
+		if err := add(t.Path, false, false, t.Tag); err != nil {
+			return nil, err
+		}
+		for _, f := range under {
+			if err := add(f, true, true, t.Tag); err != nil {
+				return nil, err
+			}
 		}
-		commit = ref.Hash().String()
 	}
+	for _, f := range files {
+		if err := add(f, true, false, ""); err != nil {
+			return nil, err
+		}
+	}
+	if err := BakupOptRebuild(ops, g.C); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
 
-	_, err = repo.GitViewFile(filePath, commit, target)
+// TagHistory lists the commits backing up files tagged tag, newest first
+func (g GitCmd) TagHistory(tag string) ([]util.TaggedCommit, error) {
+	repo, err := util.NewGitReop(g.C)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return repo.GitTagHistory(tag)
 }
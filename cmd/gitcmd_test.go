@@ -1,13 +1,25 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"anybakup/util"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 // setupTestEnv creates a temporary test environment with config and git repo
@@ -35,12 +47,12 @@ func setupTestEnv(t *testing.T) (repoDir string, config *util.Config, cleanup fu
 		t.Fatalf("Failed to write config file: %v", err)
 	}
 
-	// Set HOME to temp directory so config is loaded from there
-	oldHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
+	// Point the config lookup at the temp config file
+	oldConfig := os.Getenv("ANYBAKUP_CONFIG")
+	os.Setenv("ANYBAKUP_CONFIG", configFile)
 
 	cleanup = func() {
-		os.Setenv("HOME", oldHome)
+		os.Setenv("ANYBAKUP_CONFIG", oldConfig)
 		os.RemoveAll(tmpDir)
 	}
 
@@ -243,3 +255,1114 @@ func TestGitFile(t *testing.T) {
 		t.Error("add file error", ret.Err)
 	}
 }
+
+func TestResolveAt(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	test1txt := filepath.Join(tmpDir, "1.txt")
+	if err := os.WriteFile(test1txt, []byte("xxx"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	ret := g.AddFile(test1txt)
+	if ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+	logs, err := g.GetFileLog(ret.Dest)
+	if err != nil {
+		t.Fatal("log file error", err)
+	}
+	if commit, err := g.ResolveAt(ret.Dest, "now"); err != nil || commit != logs[0].Commit {
+		t.Errorf("expected %v, got %v %v", logs[0].Commit, commit, err)
+	}
+	if _, err := g.ResolveAt(ret.Dest, "3d"); err == nil {
+		t.Error("expected no backup 3 days ago")
+	}
+	if commit, err := g.ResolveAt(ret.Dest, logs[0].Commit[:8]); err != nil || commit != logs[0].Commit[:8] {
+		t.Errorf("expected revision to pass through, got %v %v", commit, err)
+	}
+	if _, err := g.ResolveAt(ret.Dest, "2026-13-01"); err == nil || !strings.Contains(err.Error(), "invalid time") {
+		t.Errorf("expected a bad date to fail parsing, got %v", err)
+	}
+}
+
+func TestAddFiles(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	for _, name := range []string{".bashrc", ".vimrc", ".profile"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	dira := filepath.Join(tmpDir, "a")
+	if err := os.MkdirAll(dira, 0755); err != nil {
+		t.Fatal("mkdir error", err)
+	}
+	if err := os.WriteFile(filepath.Join(dira, "1.txt"), []byte("xxx"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+
+	rets := g.AddFiles([]string{filepath.Join(tmpDir, ".*rc"), filepath.Join(tmpDir, ".profile"), dira, filepath.Join(tmpDir, "*.none")}, "dot")
+	if len(rets) != 5 {
+		t.Fatalf("expected 5 results, got %v", rets)
+	}
+	failed := 0
+	for _, ret := range rets {
+		if ret.Err != nil {
+			failed++
+			continue
+		}
+		if ret.Result != util.GitResultTypeAdd {
+			t.Errorf("expected %v to be added, got %v", ret.Src, ret.Result)
+		}
+		if tag, err := GetFileTag(ret.Dest, g.C); err != nil || tag != "dot" {
+			t.Errorf("expected tag for %v, got %v %v", ret.Dest, tag, err)
+		}
+	}
+	if failed != 1 {
+		t.Errorf("expected only the unmatched glob to fail, got %d", failed)
+	}
+
+	r, err := util.NewGitReop(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := r.GitLogPath(util.SrcPath(tmpDir).Repo())
+	if err != nil || len(logs) != 1 {
+		t.Errorf("expected a single commit, got %v %v", logs, err)
+	}
+	ops, err := GetAllOpt(c)
+	if err != nil || len(ops) != 5 {
+		t.Errorf("expected 5 tracked entries, got %v %v", ops, err)
+	}
+
+	for _, ret := range g.AddFiles([]string{filepath.Join(tmpDir, ".*")}) {
+		if ret.Err != nil || ret.Result != util.GitResultTypeNochange {
+			t.Errorf("expected no change for %v, got %v %v", ret.Src, ret.Result, ret.Err)
+		}
+	}
+}
+
+// TestAddSubFlag tests that only files below a tracked folder are marked sub
+func TestAddSubFlag(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	dira := filepath.Join(tmpDir, "a")
+	inside := filepath.Join(dira, "1.txt")
+	sibling := filepath.Join(tmpDir, "ab", "2.txt")
+	outside := filepath.Join(tmpDir, "3.txt")
+	later := filepath.Join(tmpDir, "4.txt")
+	for _, f := range []string{inside, sibling, outside, later} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal("mkdir error", err)
+		}
+		if err := os.WriteFile(f, []byte(f), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	// the folder is recorded before the files of the same batch
+	for _, ret := range g.AddFiles([]string{dira, sibling, outside}) {
+		if ret.Err != nil {
+			t.Fatal("add file error", ret.Err)
+		}
+	}
+	if ret := g.AddFile(later); ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+	ops, err := GetAllOpt(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{dira: false, inside: true, sibling: false, outside: false, later: false}
+	for _, op := range ops {
+		if sub, ok := want[op.SrcFile]; !ok || op.Sub != sub {
+			t.Errorf("expected sub=%v for %v, got %+v", sub, op.SrcFile, op)
+		}
+		delete(want, op.SrcFile)
+	}
+	if len(want) > 0 {
+		t.Errorf("expected entries for %v", want)
+	}
+}
+
+func TestSync(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	test1txt := filepath.Join(tmpDir, "1.txt")
+	test2txt := filepath.Join(tmpDir, "2.txt")
+	dira := filepath.Join(tmpDir, "a")
+	if err := os.MkdirAll(dira, 0755); err != nil {
+		t.Fatal("mkdir error", err)
+	}
+	for _, f := range []string{test1txt, test2txt, filepath.Join(dira, "1.txt")} {
+		if err := os.WriteFile(f, []byte("xxx"), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	for _, ret := range g.AddFiles([]string{test1txt, test2txt, dira}) {
+		if ret.Err != nil {
+			t.Fatal("add file error", ret.Err)
+		}
+	}
+
+	if err := os.WriteFile(test1txt, []byte("yyy"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	if err := os.Remove(test2txt); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dira, "2.txt"), []byte("zzz"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	entries, err := g.Sync("", false)
+	if err != nil {
+		t.Fatal("sync error", err)
+	}
+	want := map[string]SyncState{
+		test1txt:                     SyncUpdated,
+		test2txt:                     SyncMissing,
+		filepath.Join(dira, "1.txt"): SyncUnchanged,
+		filepath.Join(dira, "2.txt"): SyncAdded,
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %v", len(want), entries)
+	}
+	for _, e := range entries {
+		if want[e.Src] != e.State {
+			t.Errorf("expected %v for %v, got %v", want[e.Src], e.Src, e.State)
+		}
+	}
+	ops, err := GetAllOpt(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		if op.SrcFile == test1txt && op.RevCount != 2 {
+			t.Errorf("expected revcount 2 for %v, got %d", op.SrcFile, op.RevCount)
+		}
+	}
+	if !slices.ContainsFunc(ops, func(op FileOperation) bool { return op.SrcFile == filepath.Join(dira, "2.txt") }) {
+		t.Error("expected new file in tracked directory to be recorded")
+	}
+
+	entries, err = g.Sync("", false)
+	if err != nil {
+		t.Fatal("sync error", err)
+	}
+	for _, e := range entries {
+		if e.State != SyncUnchanged && e.State != SyncMissing {
+			t.Errorf("expected nothing to change for %v, got %v", e.Src, e.State)
+		}
+	}
+	if err := syncFailures(entries); err != nil {
+		t.Error("expected a missing path not to fail sync", err)
+	}
+}
+
+func TestSyncContinuesAfterError(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	big := filepath.Join(tmpDir, "big.txt")
+	small := filepath.Join(tmpDir, "small.txt")
+	for _, f := range []string{big, small} {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ret := range g.AddFiles([]string{big, small}) {
+		if ret.Err != nil {
+			t.Fatal(ret.Err)
+		}
+	}
+	c.MaxSize = 8
+	if err := os.WriteFile(big, []byte("larger than max_size"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(small, []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := g.Sync("", false)
+	if err != nil {
+		t.Fatal("sync error", err)
+	}
+	states := map[string]SyncEntry{}
+	for _, e := range entries {
+		states[e.Src] = e
+	}
+	if e := states[big]; e.State != SyncError || e.Err == "" {
+		t.Errorf("expected an error for %v, got %+v", big, e)
+	}
+	if e := states[small]; e.State != SyncUpdated {
+		t.Errorf("expected %v to be committed, got %+v", small, e)
+	}
+	if err := syncFailures(entries); err == nil {
+		t.Error("expected the failed path to fail sync")
+	}
+	if logs, err := g.GetFileLogAbs(small); err != nil || len(logs) != 2 {
+		t.Errorf("expected 2 versions of %v, got %v %v", small, logs, err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	test1txt := filepath.Join(tmpDir, "1.txt")
+	if err := os.WriteFile(test1txt, []byte("xxx"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	if ret := g.AddFile(test1txt); ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+
+	w := NewWatcher(g)
+	w.Quiet = 50 * time.Millisecond
+	backups := make(chan Result_git_add, 16)
+	w.OnBackup = func(ret Result_git_add) { backups <- ret }
+	ready := make(chan struct{}, 1)
+	w.OnReady = func() { ready <- struct{}{} }
+	dira := filepath.Join(tmpDir, "a")
+	if err := os.MkdirAll(dira, 0755); err != nil {
+		t.Fatal("mkdir error", err)
+	}
+	if err := os.WriteFile(filepath.Join(dira, "1.txt"), []byte("xxx"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	reloaded := make(chan struct{})
+	var once sync.Once
+	w.OnReload = func(roots []FileOperation) {
+		if slices.ContainsFunc(roots, func(op FileOperation) bool { return op.SrcFile == dira }) {
+			once.Do(func() { close(reloaded) })
+		}
+	}
+	// waitReady waits until Run watches the tracked paths
+	waitReady := func() {
+		t.Helper()
+		select {
+		case <-ready:
+		case <-time.After(10 * time.Second):
+			t.Fatal("watcher not ready")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	waitReady()
+
+	// touch writes file once and waits until src is backed up
+	touch := func(file, src string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte("aa"), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case ret := <-backups:
+				if ret.Src == src && ret.Err == nil && ret.Result == util.GitResultTypeAdd {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no backup of %v", src)
+			}
+		}
+	}
+	touch(test1txt, test1txt)
+
+	// a path tracked while watching is picked up, even when the first
+	// reload runs into the lock of the add
+	if ret := g.AddFile(dira); ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%v not watched", dira)
+	}
+	touch(filepath.Join(dira, "2.txt"), dira)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("watch error", err)
+	}
+
+	// a burst of writes is debounced into one backup
+	logs, err := g.GetFileLog(util.SrcPath(test1txt).Repo())
+	if err != nil {
+		t.Fatal("log file error", err)
+	}
+	w.Quiet = 200 * time.Millisecond
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() { done <- w.Run(ctx) }()
+	waitReady()
+	for i := range 5 {
+		if err := os.WriteFile(test1txt, []byte{'b', byte('a' + i)}, 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case ret := <-backups:
+		if ret.Src != test1txt || ret.Err != nil {
+			t.Errorf("unexpected backup %v", ret)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no backup after burst")
+	}
+	time.Sleep(400 * time.Millisecond)
+	cancel()
+	<-done
+	after, err := g.GetFileLog(util.SrcPath(test1txt).Repo())
+	if err != nil || len(after) != len(logs)+1 {
+		t.Errorf("expected one backup for the burst, got %d -> %d %v", len(logs), len(after), err)
+	}
+}
+
+// TestWatchQuietFlag tests that the global -q is not shadowed by a watch flag
+func TestWatchQuietFlag(t *testing.T) {
+	defer func() {
+		quiet = false
+		watchDebounce = DefaultWatchQuiet
+		logrus.SetLevel(logrus.InfoLevel)
+	}()
+	if err := watchCmd.ParseFlags([]string{"-q", "--debounce", "3s"}); err != nil {
+		t.Fatal("parse flags error", err)
+	}
+	if err := setupLogging(); err != nil {
+		t.Fatal(err)
+	}
+	if logrus.GetLevel() != logrus.ErrorLevel {
+		t.Errorf("expected quiet logging, got %v", logrus.GetLevel())
+	}
+	if watchDebounce != 3*time.Second {
+		t.Errorf("expected a 3s debounce, got %v", watchDebounce)
+	}
+}
+
+func TestAddFilesExclude(t *testing.T) {
+	repoDir, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	for _, name := range []string{"1.txt", ".cache/x", "node_modules/a.js"} {
+		p := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal("mkdir error", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	dest := util.SrcPath(tmpDir).Repo()
+	rets := g.AddFilesWith([]string{tmpDir}, AddOptions{Exclude: []string{".cache/"}})
+	if len(rets) != 1 || rets[0].Err != nil {
+		t.Fatalf("add file error %v", rets)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, dest.Sting(), ".cache")); !os.IsNotExist(err) {
+		t.Errorf("expected .cache not to be copied, got %v", err)
+	}
+
+	// the rules stick to the directory
+	if err := os.WriteFile(filepath.Join(tmpDir, ".cache", "y"), []byte("y"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	if ret := g.AddFile(tmpDir); ret.Err != nil || ret.Result != util.GitResultTypeNochange {
+		t.Errorf("expected no change, got %v %v", ret.Result, ret.Err)
+	}
+	if ret := g.AddFile(filepath.Join(tmpDir, ".cache", "y")); ret.Err == nil {
+		t.Error("expected adding an excluded file to fail")
+	}
+
+	// files backed up before a rule was added are reported
+	rets = g.AddFilesWith([]string{tmpDir}, AddOptions{Exclude: []string{".cache/", "node_modules/"}})
+	if len(rets) != 1 || rets[0].Err != nil {
+		t.Fatalf("add file error %v", rets)
+	}
+	if len(rets[0].Excluded) != 1 || !strings.HasSuffix(rets[0].Excluded[0].Sting(), "node_modules/a.js") {
+		t.Errorf("expected node_modules/a.js to be reported, got %v", rets[0].Excluded)
+	}
+
+	// a failed add stores no rules
+	skip := filepath.Join(t.TempDir(), "skip")
+	if err := os.MkdirAll(skip, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c.Exclude = []string{"skip/"}
+	if rets := g.AddFilesWith([]string{skip}, AddOptions{Exclude: []string{"*.log"}}); len(rets) != 1 || rets[0].Err == nil {
+		t.Fatalf("expected adding an excluded directory to fail, got %v", rets)
+	}
+	excludes, err := GetDirExcludes(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules, ok := excludes[util.SrcPath(skip).Repo().UnixStyle()]; ok {
+		t.Errorf("rules of a failed add were stored: %v", rules)
+	}
+}
+
+func TestSyncMirror(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	dira := filepath.Join(tmpDir, "a")
+	if err := os.MkdirAll(dira, 0755); err != nil {
+		t.Fatal("mkdir error", err)
+	}
+	for _, name := range []string{"1.txt", "2.txt"} {
+		if err := os.WriteFile(filepath.Join(dira, name), []byte(name), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	if ret := g.AddFile(dira); ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+	gone := filepath.Join(dira, "2.txt")
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := g.Sync("", false)
+	if err != nil {
+		t.Fatal("sync error", err)
+	}
+	if i := slices.IndexFunc(entries, func(e SyncEntry) bool { return e.Src == gone }); i < 0 || entries[i].State != SyncMissing {
+		t.Errorf("expected %v to be missing without mirror, got %v", gone, entries)
+	}
+
+	entries, err = g.Sync("", true)
+	if err != nil {
+		t.Fatal("sync error", err)
+	}
+	if i := slices.IndexFunc(entries, func(e SyncEntry) bool { return e.Src == gone }); i < 0 || entries[i].State != SyncDeleted {
+		t.Errorf("expected %v to be deleted with mirror, got %v", gone, entries)
+	}
+	if op, err := GetFile(util.SrcPath(gone).Repo().UnixStyle(), c); err != nil || op != nil {
+		t.Errorf("expected %v to be dropped from the tracked files", gone)
+	}
+	if err := os.Remove(filepath.Join(dira, "1.txt")); err != nil {
+		t.Fatal(err)
+	}
+	rets := g.AddFilesWith([]string{dira}, AddOptions{Mirror: true})
+	if len(rets) != 1 || rets[0].Err != nil || len(rets[0].Deleted) != 1 {
+		t.Errorf("expected add --mirror to delete 1.txt, got %v", rets)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	test1txt := filepath.Join(tmpDir, "1.txt")
+	test2txt := filepath.Join(tmpDir, "2.txt")
+	test3txt := filepath.Join(tmpDir, "3.txt")
+	dira := filepath.Join(tmpDir, "a")
+	if err := os.MkdirAll(dira, 0755); err != nil {
+		t.Fatal("mkdir error", err)
+	}
+	for _, f := range []string{test1txt, test2txt, test3txt, filepath.Join(dira, "1.txt")} {
+		if err := os.WriteFile(f, []byte("xxx"), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	for _, ret := range g.AddFiles([]string{test1txt, test2txt, dira}, "st") {
+		if ret.Err != nil {
+			t.Fatal("add file error", ret.Err)
+		}
+	}
+	if err := os.WriteFile(test1txt, []byte("yyy"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	if err := os.Remove(test2txt); err != nil {
+		t.Fatal(err)
+	}
+
+	rets, err := g.Status(test1txt, test2txt, test3txt, dira)
+	if err != nil {
+		t.Fatal("status error", err)
+	}
+	want := []TrackState{StateModified, StateMissing, StateUntracked, StateTracked}
+	for i, st := range rets {
+		if st.State != want[i] {
+			t.Errorf("expected %v for %v, got %v", want[i], st.Src, st.State)
+		}
+	}
+	if rets[0].Tag != "st" || rets[0].RevCount != 1 || rets[0].LastBackup.IsZero() {
+		t.Errorf("expected tag, revcount and backup time from the log, got %+v", rets[0])
+	}
+
+	// a new file makes the tracked directory modified
+	if err := os.WriteFile(filepath.Join(dira, "2.txt"), []byte("zzz"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	all, err := g.Status()
+	if err != nil {
+		t.Fatal("status error", err)
+	}
+	ops, _ := GetAllOpt(c)
+	if len(all) != len(ops) {
+		t.Errorf("expected every tracked entry, got %d of %d", len(all), len(ops))
+	}
+	if i := slices.IndexFunc(all, func(st FileStatus) bool { return st.Src == dira }); i < 0 || all[i].State != StateModified {
+		t.Errorf("expected %v to be modified, got %v", dira, all)
+	}
+}
+
+func TestList(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	tmpDir := t.TempDir()
+	g := GitCmd{C: c}
+	test1txt := filepath.Join(tmpDir, "1.txt")
+	dira := filepath.Join(tmpDir, "a")
+	if err := os.MkdirAll(dira, 0755); err != nil {
+		t.Fatal("mkdir error", err)
+	}
+	for _, f := range []string{test1txt, filepath.Join(dira, "1.txt"), filepath.Join(dira, "2.txt")} {
+		if err := os.WriteFile(f, []byte("xxx"), 0644); err != nil {
+			t.Fatal("write file error", err)
+		}
+	}
+	if ret := g.AddFile(test1txt, "one"); ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+	if ret := g.AddFile(dira, "dir"); ret.Err != nil {
+		t.Fatal("add file error", ret.Err)
+	}
+	if err := os.WriteFile(test1txt, []byte("yyy"), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+
+	all, err := g.List(ListOptions{})
+	if err != nil || len(all) != 4 {
+		t.Fatalf("expected 4 entries, got %v %v", all, err)
+	}
+	if !slices.IsSortedFunc(all, func(a, b ListEntry) int { return strings.Compare(a.SrcFile, b.SrcFile) }) {
+		t.Errorf("expected entries sorted by src, got %v", all)
+	}
+	if dirs, _ := g.List(ListOptions{DirOnly: true}); len(dirs) != 1 || dirs[0].SrcFile != dira {
+		t.Errorf("expected only %v, got %v", dira, dirs)
+	}
+	files, _ := g.List(ListOptions{FileOnly: true, Tag: "one"})
+	if len(files) != 1 || files[0].SrcFile != test1txt || files[0].Status != StateModified {
+		t.Errorf("expected modified %v, got %v", test1txt, files)
+	}
+	if recent, _ := g.List(ListOptions{ChangedSince: time.Now().Add(time.Hour)}); len(recent) != 0 {
+		t.Errorf("expected nothing changed in the future, got %v", recent)
+	}
+	// an entry updated mid-day counts as changed since that day
+	ops, err := GetAllOpt(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ops {
+		ops[i].UpdateTime = time.Date(2026, 9, 1, 12, 30, 0, 0, time.Local)
+		if ops[i].SrcFile != test1txt {
+			ops[i].UpdateTime = ops[i].UpdateTime.AddDate(0, 0, -1)
+		}
+	}
+	if err := BakupOptRebuild(ops, c); err != nil {
+		t.Fatal(err)
+	}
+	since, err := util.ParseSince("2026-09-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recent, _ := g.List(ListOptions{ChangedSince: since}); len(recent) != 1 || recent[0].SrcFile != test1txt {
+		t.Errorf("expected %v updated mid-day, got %v", test1txt, recent)
+	}
+	if _, err := g.List(ListOptions{Sort: "size"}); err == nil {
+		t.Error("expected unknown sort key to fail")
+	}
+
+	var buf strings.Builder
+	if err := writeList(&buf, files, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], test1txt+",") {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+	buf.Reset()
+	if err := writeList(&buf, files, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"status": "modified"`) {
+		t.Errorf("unexpected json %q", buf.String())
+	}
+}
+
+// TestJSONResults tests the json form of the add, rm and get results
+func TestJSONResults(t *testing.T) {
+	_, c, cleanup := setupTestEnv(t)
+	defer cleanup()
+	g := NewGitCmd("")
+	g.C = c
+	srcDir := t.TempDir()
+	test1txt := filepath.Join(srcDir, "1.txt")
+	if err := os.WriteFile(test1txt, []byte("xxx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rets := g.AddFiles([]string{test1txt, filepath.Join(srcDir, "missing")})
+	b, err := json.Marshal(rets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("expected 2 results, got %s", b)
+	}
+	for _, r := range decoded {
+		switch r["src"] {
+		case test1txt:
+			if r["result"] != "add" || r["error"] != nil {
+				t.Errorf("unexpected add result %v", r)
+			}
+		default:
+			if msg, _ := r["error"].(string); msg == "" {
+				t.Errorf("expected an error message, got %v", r)
+			}
+		}
+	}
+
+	dest := util.SrcPath(test1txt).Repo()
+	entries, err := g.ExportFile(dest, "", filepath.Join(t.TempDir(), "1.txt"))
+	if err != nil || len(entries) != 1 || entries[0].Path != dest.UnixStyle() {
+		t.Errorf("unexpected export %v %v", entries, err)
+	}
+	rm, err := g.RmFileResult(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(rmResult{Src: test1txt, Dest: dest, GitResult: rm})
+	if !strings.Contains(string(b), `"action":"rm"`) || !strings.Contains(string(b), `"src":`) {
+		t.Errorf("unexpected rm json %s", b)
+	}
+}
+
+// TestNonInteractiveOptions tests that --yes, --profile and --tag skip the prompts
+func TestNonInteractiveOptions(t *testing.T) {
+	_, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+	defer viper.Reset()
+	c := util.NewConfig()
+	c.Profile = map[string]util.Profile{"work": {RepoDir: "/w"}, "home": {RepoDir: "/h"}}
+	c.Default = "home"
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set("yes", true)
+	if p, err := ShowProfileOption(); err != nil || p != "home" {
+		t.Errorf("expected the default profile, got %q %v", p, err)
+	}
+	if tag, err := GetTagOption(c); err != nil || tag != "" {
+		t.Errorf("expected no tag, got %q %v", tag, err)
+	}
+	viper.Set("profile", "work")
+	viper.Set("tag", "dotfiles")
+	if p, err := ShowProfileOption(); err != nil || p != "work" {
+		t.Errorf("expected --profile, got %q %v", p, err)
+	}
+	if tag, err := GetTagOption(c); err != nil || tag != "dotfiles" {
+		t.Errorf("expected --tag, got %q %v", tag, err)
+	}
+}
+
+// TestAddSelectedProfile tests that add lands in the repo of the selected profile
+func TestAddSelectedProfile(t *testing.T) {
+	_, _, cleanup := setupTestEnv(t)
+	defer cleanup()
+	defer viper.Reset()
+	repos := map[string]string{"work": t.TempDir(), "home": t.TempDir()}
+	c := util.NewConfig()
+	c.Profile = map[string]util.Profile{}
+	for name, dir := range repos {
+		c.Profile[name] = util.Profile{RepoDir: util.RepoRoot(dir)}
+	}
+	c.Default = "home"
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srcDir := t.TempDir()
+	test1txt := filepath.Join(srcDir, "1.txt")
+	if err := os.WriteFile(test1txt, []byte("xxx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := string(util.SrcPath(test1txt).Repo())
+
+	viper.Set("yes", true)
+	for _, name := range []string{"work", "home"} {
+		viper.Set("profile", name)
+		if ret := profileGitCmd().AddFile(test1txt); ret.Err != nil {
+			t.Fatalf("add to %v failed: %v", name, ret.Err)
+		}
+		for other, dir := range repos {
+			_, err := os.Stat(filepath.Join(dir, dest))
+			if added := err == nil; added != (other == name || other == "work") {
+				t.Errorf("after adding to %v: file in %v repo = %v", name, other, added)
+			}
+		}
+	}
+
+	if _, err := LoadGitCmd("nope"); err == nil {
+		t.Error("expected an unknown profile to fail")
+	}
+	if g, err := LoadGitCmd(""); err != nil || g.C.RepoDir != c.RepoDir {
+		t.Errorf("expected the top-level config without a default profile, got %v %v", g, err)
+	}
+}
+
+// TestShowChoiceReturnsKey tests that the profile menu returns the key, not the label
+func TestShowChoiceReturnsKey(t *testing.T) {
+	m := model{choices: []string{"home       /h", "work       /w"}, keys: []string{"home", "work"}}
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	next, _ = next.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if got := next.(model).selected; got != "work" {
+		t.Errorf("expected key work, got %q", got)
+	}
+}
+
+func TestPush(t *testing.T) {
+	_, config, cleanup := setupTestEnv(t)
+	defer cleanup()
+	g := GitCmd{C: config}
+	if _, err := g.Push(); err == nil {
+		t.Error("expected push without remotes to fail")
+	}
+
+	bare := t.TempDir()
+	if _, err := git.PlainInit(bare, true); err != nil {
+		t.Fatal(err)
+	}
+	config.Remotes = map[string]util.Remote{"backup": {URL: "file://" + bare}}
+	src := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(src, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ret := g.AddFile(src); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+	if pushed, err := g.Push(); err != nil || !slices.Equal(pushed, []string{"backup"}) {
+		t.Fatalf("push: %v %v", pushed, err)
+	}
+	repo, err := git.PlainOpen(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Reference("refs/heads/master", true); err != nil {
+		t.Errorf("remote not pushed: %v", err)
+	}
+	if _, err := g.Push("nope"); err == nil {
+		t.Error("expected pushing to an unknown remote to fail")
+	}
+}
+
+func TestClone(t *testing.T) {
+	_, config, cleanup := setupTestEnv(t)
+	defer cleanup()
+	g := GitCmd{C: config}
+	src := t.TempDir()
+	dir := filepath.Join(src, "docs")
+	for _, f := range []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(src, "c.txt"), filepath.Join(src, "gone.txt")} {
+		os.MkdirAll(filepath.Dir(f), 0755)
+		if err := os.WriteFile(f, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ret := range g.AddFilesWith([]string{dir, filepath.Join(src, "c.txt")}, AddOptions{}, "work") {
+		if ret.Err != nil {
+			t.Fatal(ret.Err)
+		}
+	}
+	if ret := g.AddFile(filepath.Join(src, "gone.txt")); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+	if err := g.RmFileAbs(filepath.Join(src, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644)
+	if ret := g.AddFile(dir); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+
+	// a new machine with its own config
+	t.Setenv("ANYBAKUP_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	repoDir := filepath.Join(t.TempDir(), "clone")
+	ops, err := GitCloneProfile("file://"+config.RepoDir.String(), "laptop", repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byDest := map[string]FileOperation{}
+	for _, op := range ops {
+		byDest[op.DestFile] = op
+	}
+	docs := byDest[util.SrcPath(dir).Repo().UnixStyle().Sting()]
+	if docs.IsFile || docs.SrcFile != dir || docs.Tag != "work" {
+		t.Errorf("unexpected directory entry %+v", docs)
+	}
+	a := byDest[util.SrcPath(filepath.Join(dir, "a.txt")).Repo().UnixStyle().Sting()]
+	if !a.IsFile || !a.Sub || a.RevCount != 2 || a.Tag != "work" {
+		t.Errorf("unexpected file entry %+v", a)
+	}
+	if c := byDest[util.SrcPath(filepath.Join(src, "c.txt")).Repo().UnixStyle().Sting()]; !c.IsFile || c.Sub {
+		t.Errorf("unexpected file entry %+v", c)
+	}
+	if len(ops) != 4 {
+		t.Errorf("expected 4 entries, got %+v", ops)
+	}
+
+	cloned, err := LoadGitCmd("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloned.C.Remotes["origin"].URL != "file://"+config.RepoDir.String() {
+		t.Errorf("origin not recorded: %+v", cloned.C.Remotes)
+	}
+	all, err := GetAllOpt(cloned.C)
+	if err != nil || len(all) != 4 {
+		t.Errorf("unexpected index %v %v", all, err)
+	}
+	os.RemoveAll(src)
+	if _, err := cloned.Restore(dir, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(b) != "changed" {
+		t.Errorf("restore after clone: %q %v", b, err)
+	}
+	if _, err := GitCloneProfile(config.RepoDir.String(), "laptop", t.TempDir(), false); err == nil {
+		t.Error("expected cloning into an existing profile to fail")
+	}
+
+	// only the first clone or --default changes the default profile
+	saved := &util.Config{}
+	for _, clone := range []struct {
+		profile     string
+		makeDefault bool
+		want        string
+	}{{"desk", false, "laptop"}, {"server", true, "server"}} {
+		if _, err := GitCloneProfile(config.RepoDir.String(), clone.profile, filepath.Join(t.TempDir(), clone.profile), clone.makeDefault); err != nil {
+			t.Fatal(err)
+		}
+		if err := saved.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if saved.Default != clone.want {
+			t.Errorf("after cloning %v expected default %v, got %v", clone.profile, clone.want, saved.Default)
+		}
+	}
+
+	// a repository whose index cannot be rebuilt registers no profile
+	broken := t.TempDir()
+	repo, err := git.PlainInit(broken, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(broken, "file_operations.db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(broken, "file_operations.db", "x"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := repo.Worktree()
+	if _, err := w.Add("file_operations.db/x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Commit("ADD file_operations.db/x", &git.CommitOptions{Author: &object.Signature{Name: "t", When: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	brokenDir := filepath.Join(t.TempDir(), "broken")
+	if _, err := GitCloneProfile(broken, "broken", brokenDir, false); err == nil {
+		t.Fatal("expected cloning a repository with a broken index to fail")
+	}
+	saved = &util.Config{}
+	if err := saved.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Profile["broken"]; ok {
+		t.Error("expected the profile not to be registered")
+	}
+	if _, err := os.Stat(brokenDir); !os.IsNotExist(err) {
+		t.Errorf("expected the clone to be removed, got %v", err)
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	_, config, cleanup := setupTestEnv(t)
+	defer cleanup()
+	g := GitCmd{C: config}
+	src := t.TempDir()
+	file := filepath.Join(src, "a.txt")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ret := g.AddFile(file); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+	dest := util.SrcPath(file).Repo().UnixStyle()
+	if err := SetFileTag(dest, "keep", config); err != nil {
+		t.Fatal(err)
+	}
+
+	// a commit made with git directly
+	repo, err := git.PlainOpen(config.RepoDir.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(src, "outside.txt")
+	outsideDest := util.SrcPath(outside).Repo().UnixStyle()
+	os.MkdirAll(filepath.Dir(config.RepoDir.With(outsideDest.Sting())), 0755)
+	if err := os.WriteFile(config.RepoDir.With(outsideDest.Sting()), []byte("o"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(outsideDest.Sting())
+	when := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := w.Commit("by hand", &git.CommitOptions{Author: &object.Signature{Name: "me", When: when}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := g.RebuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", ops)
+	}
+	if tag, err := GetFileTag(dest, config); err != nil || tag != "keep" {
+		t.Errorf("tag not kept: %q %v", tag, err)
+	}
+	op, err := GetFile(outsideDest, config)
+	if err != nil || op == nil {
+		t.Fatalf("outside commit not indexed: %v", err)
+	}
+	if op.SrcFile != outside || !op.IsFile || op.RevCount != 1 || !op.AddTime.Equal(when) || !op.UpdateTime.Equal(when) {
+		t.Errorf("unexpected entry %+v", op)
+	}
+
+	// a lost database
+	if err := os.Remove(config.RepoDir.With("file_operations.db")); err != nil {
+		t.Fatal(err)
+	}
+	if ops, err := g.RebuildIndex(); err != nil || len(ops) != 2 {
+		t.Errorf("rebuild without database: %+v %v", ops, err)
+	}
+	if op, err := GetFile(dest, config); err != nil || op == nil || op.SrcFile != file {
+		t.Errorf("unexpected entry %+v %v", op, err)
+	}
+}
+
+func TestTagsSurviveClone(t *testing.T) {
+	_, config, cleanup := setupTestEnv(t)
+	defer cleanup()
+	g := GitCmd{C: config}
+	src := t.TempDir()
+	dir := filepath.Join(src, "docs")
+	os.MkdirAll(dir, 0755)
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ret := g.AddFile(dir); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+	// tagged after the backup, so the commit message has no tag
+	if err := SetFileTag(util.SrcPath(dir).Repo().UnixStyle(), "work", config); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := g.TagHistory("work"); err != nil || len(history) != 0 {
+		t.Errorf("untagged version found: %+v %v", history, err)
+	}
+	os.WriteFile(file, []byte("changed"), 0644)
+	if ret := g.AddFile(dir); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+	history, err := g.TagHistory("work")
+	if err != nil || len(history) != 1 || len(history[0].Files) != 1 {
+		t.Errorf("tagged version not found: %+v %v", history, err)
+	}
+
+	t.Setenv("ANYBAKUP_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	if _, err := GitCloneProfile(config.RepoDir.String(), "laptop", filepath.Join(t.TempDir(), "clone"), false); err != nil {
+		t.Fatal(err)
+	}
+	cloned, err := LoadGitCmd("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{dir, file} {
+		if tag, err := GetFileTag(util.SrcPath(p).Repo().UnixStyle(), cloned.C); err != nil || tag != "work" {
+			t.Errorf("tag of %v after clone %q %v", p, tag, err)
+		}
+	}
+}
+
+func TestAddFilesWithTag(t *testing.T) {
+	_, config, cleanup := setupTestEnv(t)
+	defer cleanup()
+	g := GitCmd{C: config}
+	src := t.TempDir()
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	for _, f := range []string{a, b} {
+		if err := os.WriteFile(f, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ret := g.AddFile(a); ret.Err != nil {
+		t.Fatal(ret.Err)
+	}
+	commits := func() (n int) {
+		repo, err := git.PlainOpen(config.RepoDir.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := repo.Log(&git.LogOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter.ForEach(func(*object.Commit) error { n++; return nil })
+		return n
+	}
+	before := commits()
+	// the new file and the tag of the unchanged one go into one commit
+	for _, ret := range g.AddFilesWith([]string{a, b}, AddOptions{}, "work") {
+		if ret.Err != nil {
+			t.Fatal(ret.Err)
+		}
+	}
+	if n := commits(); n != before+1 {
+		t.Errorf("expected a single commit, got %d", n-before)
+	}
+	// unchanged paths only get a tag commit
+	for _, ret := range g.AddFilesWith([]string{a, b}, AddOptions{}, "home") {
+		if ret.Err != nil {
+			t.Fatal(ret.Err)
+		}
+	}
+	if n := commits(); n != before+2 {
+		t.Errorf("expected a tag commit, got %d", n-before)
+	}
+	for _, f := range []string{a, b} {
+		if tag, err := GetFileTag(util.SrcPath(f).Repo().UnixStyle(), config); err != nil || tag != "home" {
+			t.Errorf("tag of %v %q %v", f, tag, err)
+		}
+	}
+}
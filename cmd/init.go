@@ -12,18 +12,18 @@ import (
 
 func GitInitProfile(profile, repoPath string) (*util.GitRepo, error) {
 	if err := os.MkdirAll(repoPath, 0o755); err != nil {
-		fmt.Printf("Error creating directory: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("error creating directory: %v", err)
 	}
 	p := util.Profile{
 		RepoDir: util.RepoRoot(repoPath),
 	}
-	c := util.NewConfig()
+	c := &util.Config{}
+	if err := c.Load(); err != nil {
+		return nil, err
+	}
 	if err := c.SetProfile(profile, p); err != nil {
-		c.Print()
 		return nil, fmt.Errorf("error saving config: %v", err)
 	}
-	c.Print()
 	// Initialize git repository
 	if ret, err := util.NewGitReop(c); err != nil {
 		return ret, fmt.Errorf("error initializing git repository: %v", err)
@@ -32,6 +32,12 @@ func GitInitProfile(profile, repoPath string) (*util.GitRepo, error) {
 	}
 }
 
+// initResult is the json output of init
+type initResult struct {
+	Profile string        `json:"profile"`
+	RepoDir util.RepoRoot `json:"repodir"`
+}
+
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init [directory] [profile]",
@@ -42,8 +48,7 @@ var initCmd = &cobra.Command{
 		repoPath := args[0]
 		absPath, err := filepath.Abs(repoPath)
 		if err != nil {
-			fmt.Printf("Error getting absolute path: %v\n", err)
-			os.Exit(1)
+			fatalf("Error getting absolute path: %v", err)
 		}
 
 		profile := ""
@@ -51,12 +56,18 @@ var initCmd = &cobra.Command{
 			profile = args[1]
 		}
 
-		if ret, err := GitInitProfile(profile, absPath); err != nil {
-			fmt.Printf("Error initializing profile: %v\n", err)
-		} else if ret != nil {
-			fmt.Printf("Initialized profile %s at %v\n", profile, ret)
+		if _, err := GitInitProfile(profile, absPath); err != nil {
+			fatalf("Error initializing profile: %v", err)
+		}
+		if profile == "" {
+			profile = "default"
+		}
+		if jsonOutput() {
+			printJSON(initResult{Profile: profile, RepoDir: util.RepoRoot(absPath)})
+			return
 		}
-		os.Exit(1)
+		util.NewConfig().Print()
+		fmt.Printf("Initialized profile %s at %v\n", profile, absPath)
 	},
 }
 
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"anybakup/util"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsTag          string
+	lsDirOnly      bool
+	lsFileOnly     bool
+	lsChangedSince string
+	lsSort         string
+	lsReverse      bool
+)
+
+// writeList prints entries as a table, json or csv
+func writeList(w io.Writer, entries []ListEntry, format string) error {
+	switch format {
+	case "", "text", "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATUS\tTAG\tREVS\tADDED\tUPDATED\tSRC\tDEST")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", e.Status, e.Tag, e.RevCount,
+				e.AddTime.Local().Format(time.DateTime), e.UpdateTime.Local().Format(time.DateTime), e.SrcFile, e.DestFile)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"srcfile", "destfile", "isfile", "revcount", "tag", "add_time", "update_time", "status"})
+		for _, e := range entries {
+			cw.Write([]string{e.SrcFile, e.DestFile, strconv.FormatBool(e.IsFile), strconv.Itoa(e.RevCount), e.Tag,
+				e.AddTime.Format(time.RFC3339), e.UpdateTime.Format(time.RFC3339), string(e.Status)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown output format %q, use text, table, json or csv", format)
+}
+
+// lsCmd represents the ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List tracked files and directories",
+	Long: `List every tracked file and directory with its backup count, tag, add and update time
+and whether the source changed since the last backup.
+--changed-since takes a time such as "2026-09-01", "yesterday" or "3d"; a day
+without a clock counts from its start.
+The global --output flag selects text (a table), json or csv.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := ListOptions{Tag: lsTag, DirOnly: lsDirOnly, FileOnly: lsFileOnly, Sort: lsSort, Reverse: lsReverse}
+		if lsDirOnly && lsFileOnly {
+			fatalf("Error: --dir-only and --file-only are mutually exclusive")
+		}
+		if lsChangedSince != "" {
+			t, err := util.ParseSince(lsChangedSince)
+			if err != nil {
+				fatalf("Error ls: [%v]", err)
+			}
+			opt.ChangedSince = t
+		}
+		g := profileGitCmd()
+		entries, err := g.List(opt)
+		if err == nil {
+			err = writeList(os.Stdout, entries, outputFormat)
+		}
+		if err != nil {
+			fatalf("Error ls: [%v]", err)
+		}
+	},
+}
+
+func init() {
+	lsCmd.Flags().StringVar(&lsTag, "tag", "", "only list entries with this tag")
+	lsCmd.Flags().BoolVar(&lsDirOnly, "dir-only", false, "only list directories")
+	lsCmd.Flags().BoolVar(&lsFileOnly, "file-only", false, "only list files")
+	lsCmd.Flags().StringVar(&lsChangedSince, "changed-since", "", "only list entries backed up at or after this time")
+	lsCmd.Flags().StringVar(&lsSort, "sort", "src", "sort by src, dest, revcount, tag, added or updated")
+	lsCmd.Flags().BoolVarP(&lsReverse, "reverse", "r", false, "reverse the sort order")
+	rootCmd.AddCommand(lsCmd)
+}
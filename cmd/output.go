@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// outputFormat is the value of the global --output flag
+var outputFormat string
+
+// outputFormats lists the values accepted by --output; table and csv only
+// change the output of ls
+var outputFormats = []string{"text", "json", "table", "csv"}
+
+// checkOutput validates --output
+func checkOutput() error {
+	if !slices.Contains(outputFormats, outputFormat) {
+		return fmt.Errorf("unknown output format %q, use text, json, table or csv", outputFormat)
+	}
+	return nil
+}
+
+// jsonOutput reports whether results are printed as json
+func jsonOutput() bool {
+	return outputFormat == "json"
+}
+
+// printJSON writes v to stdout as indented json
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logrus.Errorf("encode json: %v", err)
+	}
+}
+
+// fatalf logs an error to stderr and exits with status 1
+func fatalf(format string, args ...any) {
+	logrus.Errorf(format, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"anybakup/util"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+var profileDeleteRepo bool
+
+// profileEntry is the json output of profile list and show
+type profileEntry struct {
+	Name    string        `json:"name"`
+	Default bool          `json:"default"`
+	RepoDir util.RepoRoot `json:"repodir"`
+	Profile *util.Profile `json:"profile,omitempty"`
+}
+
+// loadConfig loads the config file, exiting if it cannot be read
+func loadConfig() *util.Config {
+	c := &util.Config{}
+	if err := c.Load(); err != nil {
+		fatalf("%v", err)
+	}
+	return c
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage profiles",
+	Long: `List, show, rename and remove profiles, choose the default profile and change profile settings.
+A profile names a backup repository and its settings in config.yaml.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := loadConfig()
+		entries := []profileEntry{}
+		for _, name := range c.ProfileNames() {
+			entries = append(entries, profileEntry{Name: name, Default: name == c.Default, RepoDir: c.Profile[name].RepoDir})
+		}
+		if jsonOutput() {
+			printJSON(entries)
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "\tNAME\tREPODIR")
+		for _, e := range entries {
+			mark := ""
+			if e.Default {
+				mark = "*"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", mark, e.Name, e.RepoDir)
+		}
+		tw.Flush()
+	},
+}
+
+var profileShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the settings of a profile, the default profile without a name",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := loadConfig()
+		name := c.Default
+		if len(args) > 0 {
+			name = args[0]
+		}
+		p, ok := c.Profile[name]
+		if !ok {
+			fatalf("unknown profile %q", name)
+		}
+		if jsonOutput() {
+			printJSON(profileEntry{Name: name, Default: name == c.Default, RepoDir: p.RepoDir, Profile: &p})
+			return
+		}
+		b, err := yaml.Marshal(map[string]util.Profile{name: p})
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Print(string(b))
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Make a profile the default profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loadConfig().UseProfile(args[0]); err != nil {
+			fatalf("Error use profile: %v", err)
+		}
+		fmt.Printf("default profile %s\n", args[0])
+	},
+}
+
+var profileRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Remove a profile",
+	Long: `Remove a profile from the config. The backup repository is kept unless --delete-repo is given,
+which asks for confirmation first; --yes confirms without asking.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		c := loadConfig()
+		p, ok := c.Profile[name]
+		if !ok {
+			fatalf("unknown profile %q", name)
+		}
+		if profileDeleteRepo {
+			if err := checkRepoDeletable(c, name, p.RepoDir); err != nil {
+				fatalf("Error remove profile: %v", err)
+			}
+			ok, err := confirm(fmt.Sprintf("Delete the repository %s?", p.RepoDir))
+			if err != nil {
+				fatalf("Error remove profile: %v", err)
+			}
+			if !ok {
+				fatalf("Error remove profile: not confirmed")
+			}
+		}
+		if _, err := c.RemoveProfile(name); err != nil {
+			fatalf("Error remove profile: %v", err)
+		}
+		fmt.Printf("removed profile %s\n", name)
+		if profileDeleteRepo {
+			if err := os.RemoveAll(p.RepoDir.String()); err != nil {
+				fatalf("Error delete repository: %v", err)
+			}
+			fmt.Printf("deleted %s\n", p.RepoDir)
+		}
+	},
+}
+
+// checkRepoDeletable refuses to delete directories that are not a backup
+// repository or that another profile still uses
+func checkRepoDeletable(c *util.Config, name string, dir util.RepoRoot) error {
+	if dir == "" {
+		return fmt.Errorf("profile %q has no repodir", name)
+	}
+	if _, err := os.Stat(filepath.Join(dir.String(), ".git")); err != nil {
+		return fmt.Errorf("%v is not a backup repository", dir)
+	}
+	for other, p := range c.Profile {
+		if other != name && p.RepoDir == dir {
+			return fmt.Errorf("%v is also used by profile %q", dir, other)
+		}
+	}
+	return nil
+}
+
+var profileMvCmd = &cobra.Command{
+	Use:   "mv [name] [new name]",
+	Short: "Rename a profile",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loadConfig().RenameProfile(args[0], args[1]); err != nil {
+			fatalf("Error rename profile: %v", err)
+		}
+		fmt.Printf("renamed profile %s to %s\n", args[0], args[1])
+	},
+}
+
+var profileSetCmd = &cobra.Command{
+	Use:   "set [name] [key] [value]",
+	Short: "Change a setting of a profile, creating the profile if needed",
+	Long: `Change a setting of a profile. A new profile is created when its repodir is set.
+Keys: ` + strings.Join(util.ProfileKeys, ", ") + `.
+List values such as exclude are comma separated; an empty value clears the setting.`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := loadConfig().SetProfileValue(args[0], args[1], args[2]); err != nil {
+			fatalf("Error set profile: %v", err)
+		}
+		fmt.Printf("set %s %s\n", args[0], args[1])
+	},
+}
+
+func init() {
+	profileRmCmd.Flags().BoolVar(&profileDeleteRepo, "delete-repo", false, "also delete the backup repository")
+	profileCmd.AddCommand(profileListCmd, profileShowCmd, profileUseCmd, profileRmCmd, profileMvCmd, profileSetCmd)
+	rootCmd.AddCommand(profileCmd)
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// countTracked counts the paths added on their own, not as part of a directory
+func countTracked(ops []FileOperation) int {
+	n := 0
+	for _, op := range ops {
+		if !op.Sub {
+			n++
+		}
+	}
+	return n
+}
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the file index from the git history",
+	Long: `Rebuild file_operations.db of a profile from the repository, for example after commits made
+with git directly or when the database was lost. Tracked paths are taken from the commit messages,
+files from HEAD, and revision counts and times from the commits touching each path.
+Tags in the old index are kept; otherwise they are read from .anybakup/tags.json, and for
+backups made before tags were committed, from the commit messages.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ops, err := profileGitCmd().RebuildIndex()
+		if err != nil {
+			fatalf("Error reindex: %v", err)
+		}
+		if jsonOutput() {
+			printJSON(ops)
+			return
+		}
+		fmt.Printf("reindexed %d paths, %d tracked\n", len(ops), countTracked(ops))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"anybakup/util"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	remoteAutoPush bool
+	remoteGlobal   bool
+)
+
+// remoteEntry is the json output of remote list
+type remoteEntry struct {
+	Name string `json:"name"`
+	util.Remote
+}
+
+// remoteProfile returns the config and the profile whose remotes are changed,
+// or an empty profile for --global. Without --global a profile must be
+// selected.
+func remoteProfile() (*util.Config, string) {
+	if remoteGlobal {
+		return loadConfig(), ""
+	}
+	profile, err := ShowProfileOption()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if profile == "" {
+		// an empty profile would change the global remotes
+		fatalf("no profile selected; use --profile or --global")
+	}
+	return loadConfig(), profile
+}
+
+// remoteURL makes existing local paths absolute so the remote does not
+// depend on the working directory
+func remoteURL(url string) string {
+	if strings.Contains(url, "://") {
+		return url
+	}
+	if _, err := os.Stat(url); err != nil {
+		return url
+	}
+	if abs, err := filepath.Abs(url); err == nil {
+		return abs
+	}
+	return url
+}
+
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Manage the remotes of a profile",
+	Long: `Add, remove and list the remotes the backup repository is pushed to.
+A remote is any url go-git can push to, including a local bare repository or a file:// url.
+With --auto-push every backup commit is pushed to the remote.
+With --global, add and rm change the remotes shared by every profile.`,
+}
+
+var remoteAddCmd = &cobra.Command{
+	Use:   "add [name] [url]",
+	Short: "Add or replace a remote",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, profile := remoteProfile()
+		r := util.Remote{URL: remoteURL(args[1]), AutoPush: remoteAutoPush}
+		if err := c.SetRemote(profile, args[0], r); err != nil {
+			fatalf("Error add remote: %v", err)
+		}
+		fmt.Printf("added remote %s %s\n", args[0], r.URL)
+	},
+}
+
+var remoteRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Remove a remote",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, profile := remoteProfile()
+		if err := c.RemoveRemote(profile, args[0]); err != nil {
+			fatalf("Error remove remote: %v", err)
+		}
+		fmt.Printf("removed remote %s\n", args[0])
+	},
+}
+
+var remoteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the remotes of a profile, including the global ones",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		g := profileGitCmd()
+		entries := []remoteEntry{}
+		for _, name := range slices.Sorted(maps.Keys(g.C.Remotes)) {
+			entries = append(entries, remoteEntry{Name: name, Remote: g.C.Remotes[name]})
+		}
+		if jsonOutput() {
+			printJSON(entries)
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tURL\tAUTO PUSH")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%v\n", e.Name, e.URL, e.AutoPush)
+		}
+		tw.Flush()
+	},
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push [remote]...",
+	Short: "Push the backup repository to its remotes",
+	Long:  `Push every branch of the backup repository to the given remotes, or to all remotes of the profile.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pushed, err := profileGitCmd().Push(args...)
+		if jsonOutput() {
+			printJSON(pushed)
+		} else {
+			for _, name := range pushed {
+				fmt.Printf("pushed %s\n", name)
+			}
+		}
+		if err != nil {
+			fatalf("Error push: %v", err)
+		}
+	},
+}
+
+func init() {
+	remoteAddCmd.Flags().BoolVar(&remoteAutoPush, "auto-push", false, "push after every backup commit")
+	for _, c := range []*cobra.Command{remoteAddCmd, remoteRmCmd} {
+		c.Flags().BoolVar(&remoteGlobal, "global", false, "change the global remotes instead of the profile's")
+	}
+	remoteCmd.AddCommand(remoteAddCmd, remoteRmCmd, remoteListCmd)
+	rootCmd.AddCommand(remoteCmd, pushCmd)
+}
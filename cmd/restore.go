@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreAt     string
+	restoreDryRun bool
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [file|dir]",
+	Short: "Restore a file or directory to its original location",
+	Long: `Restore a backed up file or directory to the absolute path it was backed up from.
+Permissions stored in the backup are restored as well.
+--at selects a commit hash or a time such as "2026-09-01 12:00",
+"yesterday 18:00" or "3d"; the newest backup at or before that time is used. Without --at the latest backup is used.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath := args[0]
+		g := profileGitCmd()
+		entries, err := g.Restore(filePath, restoreAt, restoreDryRun)
+		if err != nil {
+			fatalf("Error restore %v: [%v]", filePath, err)
+		}
+		if jsonOutput() {
+			printJSON(entries)
+			return
+		}
+		for _, e := range entries {
+			state := "create"
+			if e.Exists {
+				state = "overwrite"
+			}
+			if restoreDryRun {
+				fmt.Printf("%-10s %v %v\n", state, e.Mode, e.Target)
+			} else {
+				fmt.Printf("restore %s %v\n", e.Target, e.Mode)
+			}
+		}
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreAt, "at", "", "commit or time to restore from")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "list files that would be written without writing them")
+	rootCmd.AddCommand(restoreCmd)
+}
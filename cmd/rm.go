@@ -2,10 +2,20 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
+
+	"anybakup/util"
 
 	"github.com/spf13/cobra"
 )
 
+// rmResult is the json output of rm
+type rmResult struct {
+	Src  string        `json:"src"`
+	Dest util.RepoPath `json:"dest"`
+	util.GitResult
+}
+
 // rmCmd represents the rm command
 var rmCmd = &cobra.Command{
 	Use:   "rm [file]",
@@ -13,16 +23,19 @@ var rmCmd = &cobra.Command{
 	Long:  `Remove a file from the repository. This does not delete the original file, only the backup.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		profile, err := ShowProfileOption()
+		filePath := args[0]
+		absPath, err := filepath.Abs(filePath)
 		if err != nil {
-			fmt.Println(err)
-			return
+			fatalf("Error rm %v: [%v]", filePath, err)
 		}
-		filePath := args[0]
-		g := NewGitCmd(profile)
-		err = g.RmFileAbs(filePath)
+		g := profileGitCmd()
+		repoPath := util.SrcPath(absPath).Repo()
+		ret, err := g.RmFileResult(repoPath)
 		if err != nil {
-			fmt.Println(err)
+			fatalf("Error rm %v: [%v]", filePath, err)
+		}
+		if jsonOutput() {
+			printJSON(rmResult{Src: absPath, Dest: repoPath, GitResult: ret})
 		} else {
 			fmt.Printf("rm %s OK\n", filePath)
 		}
@@ -3,48 +3,96 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
+	"anybakup/util"
+
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-// var cfgFile string
+var cfgFile string
+
+var (
+	verbose bool
+	quiet   bool
+)
 
 var rootCmd = &cobra.Command{
 	Use:   "anybakup",
 	Short: "A simple backup tool",
-	Long:  `A simple backup tool that allows you to add files to a repository and manage them.`,
+	Long: `A simple backup tool that allows you to add files to a repository and manage them.
+--output json prints the results of add, rm, log, get, status, init and ls as json;
+diagnostics always go to stderr. --verbose and --quiet override the log_level config key.
+--profile selects the profile instead of asking; without a terminal on stdin or with --yes
+the default profile of the config is used. --profile, --yes and the --tag of add can also be
+set with the ANYBAKUP_PROFILE, ANYBAKUP_YES and ANYBAKUP_TAG environment variables.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		return checkOutput()
+	},
+}
+
+// setupLogging sets the log level from --verbose, --quiet or log_level
+func setupLogging() error {
+	if verbose && quiet {
+		return fmt.Errorf("--verbose and --quiet are mutually exclusive")
+	}
+	level := ""
+	switch {
+	case verbose:
+		level = "debug"
+	case quiet:
+		level = "error"
+	default:
+		c := util.Config{}
+		if err := c.Load(); err == nil {
+			level = c.LogLevel
+		}
+	}
+	if err := util.SetLogLevel(level); err != nil {
+		return fmt.Errorf("log_level: %v", err)
+	}
+	return nil
 }
 
 func Execute() {
+	// cobra reports the error on stderr
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "log debug messages")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only log errors")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "output format: text or json (ls also takes table and csv)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default $ANYBAKUP_CONFIG, $XDG_CONFIG_HOME/anybakup/config.yaml or ~/.config/anybakup/config.yaml)")
+	rootCmd.PersistentFlags().String("profile", "", "profile to use instead of asking")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "never prompt: use the default profile and no tag, and confirm everything")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindPFlag("yes", rootCmd.PersistentFlags().Lookup("yes"))
 }
 
 func initConfig() {
-	home, err := os.UserHomeDir()
+	if cfgFile != "" {
+		util.SetConfigFile(cfgFile)
+	}
+	file, err := util.ConfigFile()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fatalf("%v", err)
 	}
-
-	// Search config in ~/.config/anybakup directory with name "config" (without extension).
-	configPath := filepath.Join(home, ".config", "anybakup")
-	viper.AddConfigPath(configPath)
+	viper.SetConfigFile(file)
 	viper.SetConfigType("yaml")
-	viper.SetConfigName("config")
 
-	viper.AutomaticEnv() // read in environment variables that match
+	viper.SetEnvPrefix("anybakup")
+	viper.AutomaticEnv() // read in environment variables that match, e.g. ANYBAKUP_PROFILE
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		logrus.Debugf("Using config file: %v", viper.ConfigFileUsed())
 	}
 }
@@ -2,38 +2,35 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // statusCmd represents the status command
 var statusCmd = &cobra.Command{
-	Use:   "status [file]",
-	Short: "Check the status of a file",
-	Long:  `Check if a file is tracked in the repository.`,
-	Args:  cobra.ExactArgs(1),
+	Use:   "status [path]...",
+	Short: "Show whether files changed since their last backup",
+	Long: `Compare files or directories with their last backup. Each path is reported as
+tracked (unchanged since the backup), modified (changed since the backup),
+missing (gone at the source) or untracked, with its tag, number of backups
+and the time of the last backup. Without arguments every tracked entry is reported.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		filePath := args[0]
-		fileName := filepath.Base(filePath)
-
-		repoDir := viper.GetString("repodir")
-		if repoDir == "" {
-			fmt.Println("Repository directory not configured. Run 'anybakup init <dir>' first.")
-			os.Exit(1)
+		g := profileGitCmd()
+		rets, err := g.Status(args...)
+		if err != nil {
+			fatalf("Error checking status: %v", err)
 		}
-
-		destPath := filepath.Join(repoDir, fileName)
-
-		if _, err := os.Stat(destPath); err == nil {
-			fmt.Printf("File '%s' is tracked in repository.\n", fileName)
-		} else if os.IsNotExist(err) {
-			fmt.Printf("File '%s' is NOT tracked in repository.\n", fileName)
-		} else {
-			fmt.Printf("Error checking status: %v\n", err)
-			os.Exit(1)
+		if jsonOutput() {
+			printJSON(rets)
+			return
+		}
+		fmt.Printf("%-10s %-10s %4s %-19s %s\n", "STATE", "TAG", "REVS", "LAST BACKUP", "PATH")
+		for _, st := range rets {
+			last := "-"
+			if st.State != StateUntracked {
+				last = st.LastBackup.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-10s %-10s %4d %-19s %s\n", st.State, st.Tag, st.RevCount, last, st.Src)
 		}
 	},
 }
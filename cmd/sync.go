@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncTag    string
+	syncMirror bool
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Back up every tracked file that changed since the last backup",
+	Long: `Copy every tracked file and directory again and commit all changes as a single snapshot.
+With --tag only entries carrying that tag are synced. Each tracked file is reported as
+added (new in a tracked directory), updated, unchanged, missing (gone at the source) or
+error (could not be copied, for example when larger than max_size; the rest is still committed).
+The exit status is non-zero when any entry is reported as error.
+With --mirror files gone from a tracked directory are deleted from the backup and reported as deleted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		g := profileGitCmd()
+		entries, err := g.Sync(syncTag, syncMirror)
+		if jsonOutput() {
+			printJSON(entries)
+		} else {
+			for _, e := range entries {
+				if e.Err != "" {
+					fmt.Printf("%-10s %s: %s\n", e.State, e.Src, e.Err)
+					continue
+				}
+				fmt.Printf("%-10s %s\n", e.State, e.Src)
+			}
+		}
+		if err != nil {
+			fatalf("Error sync: [%v]", err)
+		}
+		if err := syncFailures(entries); err != nil {
+			fatalf("Error sync: [%v]", err)
+		}
+	},
+}
+
+// syncFailures returns an error when any entry ended in SyncError, so
+// scripts running sync can detect failed paths
+func syncFailures(entries []SyncEntry) error {
+	failed := 0
+	for _, e := range entries {
+		if e.State == SyncError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d paths failed", failed, len(entries))
+	}
+	return nil
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&syncTag, "tag", "", "only sync entries with this tag")
+	syncCmd.Flags().BoolVar(&syncMirror, "mirror", false, "delete files from the backup that were deleted in tracked directories")
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"anybakup/util"
+
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage tags",
+	Long: `Set, list and search tags. Tags are committed to .anybakup/tags.json in the backup repository,
+so they survive clone and reindex and old versions can be searched by tag.
+The tag of a directory applies to every file below it.`,
+}
+
+var tagSetCmd = &cobra.Command{
+	Use:   "set [file|dir] [tag]",
+	Short: "Tag a tracked file or directory, an empty tag removes it",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		abs, err := filepath.Abs(args[0])
+		if err != nil {
+			fatalf("Error getting absolute path: %v", err)
+		}
+		g := profileGitCmd()
+		if err := SetFileTag(util.SrcPath(abs).Repo().UnixStyle(), args[1], g.C); err != nil {
+			fatalf("Error set tag %v: %v", abs, err)
+		}
+		fmt.Printf("tagged %s %s\n", abs, args[1])
+	},
+}
+
+var tagListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the tags in use",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tags, err := GetAllTags(profileGitCmd().C)
+		if err != nil {
+			fatalf("Error list tags: %v", err)
+		}
+		if jsonOutput() {
+			if tags == nil {
+				tags = []string{}
+			}
+			printJSON(tags)
+			return
+		}
+		for _, t := range tags {
+			fmt.Println(t)
+		}
+	},
+}
+
+var tagLogCmd = &cobra.Command{
+	Use:   "log [tag]",
+	Short: "List the backups of files with a tag, newest first",
+	Long:  `List every commit that backed up files carrying the tag at the time of the commit.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		commits, err := profileGitCmd().TagHistory(args[0])
+		if err != nil {
+			fatalf("Error tag log %v: %v", args[0], err)
+		}
+		if jsonOutput() {
+			printJSON(commits)
+			return
+		}
+		for _, c := range commits {
+			fmt.Printf("%-10s %-10s %-10s\n", c.Commit, c.Author, c.Date)
+			for _, f := range c.Files {
+				src, err := f.PlatformStyle().ToSrc()
+				if err != nil {
+					continue
+				}
+				fmt.Printf("    %s\n", src)
+			}
+		}
+	},
+}
+
+func init() {
+	tagCmd.AddCommand(tagSetCmd, tagListCmd, tagLogCmd)
+	rootCmd.AddCommand(tagCmd)
+}
@@ -2,12 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"maps"
+	"os"
+	"slices"
 
 	"anybakup/util"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -18,8 +23,10 @@ var (
 )
 
 type model struct {
-	cursor   int
-	choices  []string
+	cursor  int
+	choices []string
+	// keys holds the value returned for each choice
+	keys     []string
 	selected string
 	done     bool
 	title    string
@@ -51,7 +58,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 
 		case tea.KeyEnter:
-			m.selected = m.choices[m.cursor]
+			m.selected = m.keys[m.cursor]
 			m.done = true
 			return m, tea.Quit
 
@@ -145,44 +152,98 @@ func (m model) View() string {
 	return s
 }
 
+// interactive reports whether the TUI may prompt: stdin is a terminal and
+// --yes is not set
+func interactive() bool {
+	if viper.GetBool("yes") {
+		return false
+	}
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// confirm asks a yes/no question. --yes answers yes; without a terminal it
+// fails instead of assuming an answer.
+func confirm(question string) (bool, error) {
+	if viper.GetBool("yes") {
+		return true, nil
+	}
+	if !interactive() {
+		return false, fmt.Errorf("%v needs confirmation, use --yes", question)
+	}
+	answer, err := ShowOption([]string{"no", "yes"}, question)
+	return answer == "yes", err
+}
+
+// GetTagOption returns --tag if given, otherwise the default_tag of the
+// profile, otherwise asks for a tag. Without a terminal no tag is used.
 func GetTagOption(c *util.Config) (string, error) {
+	if viper.IsSet("tag") {
+		return viper.GetString("tag"), nil
+	}
+	if c.DefaultTag != "" || !interactive() {
+		return c.DefaultTag, nil
+	}
 	tags, _ := GetAllTags(c)
 	for _, v := range tags {
-		fmt.Println(v)
+		fmt.Fprintln(os.Stderr, v)
 	}
 	return ShowInput("Enter tag name:", "tag name")
 }
 
+// ShowProfileOption returns --profile if given, otherwise asks for a
+// profile. Without a terminal the default profile of the config is used.
+// The result is a key of the profile map, or empty when none is configured.
 func ShowProfileOption() (string, error) {
+	if p := viper.GetString("profile"); p != "" {
+		return p, nil
+	}
 	config := util.NewConfig()
-
-	// Extract profile names from the map
-	var profileNames []string
-	if config.Profile != nil {
-		for name := range config.Profile {
-			c := config.GetProfile(name)
-			if c == nil {
-				continue
-			}
-			ss := fmt.Sprintf("%-10s %-150s", name, string(c.RepoDir))
-			profileNames = append(profileNames, ss)
-		}
+	if !interactive() {
+		return config.Default, nil
 	}
 
-	if len(profileNames) == 0 {
-		return "default", nil
+	names := slices.Sorted(maps.Keys(config.Profile))
+	if len(names) == 0 {
+		return "", nil
+	}
+	labels := make([]string, len(names))
+	for i, name := range names {
+		labels[i] = fmt.Sprintf("%-10s %s", name, config.Profile[name].RepoDir)
 	}
+	return ShowChoice(names, labels, "Select a profile:")
+}
 
-	return ShowOption(profileNames, "Select a profile:")
+// profileGitCmd opens the profile selected by ShowProfileOption and exits
+// if it cannot be used
+func profileGitCmd() *GitCmd {
+	profile, err := ShowProfileOption()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	g, err := LoadGitCmd(profile)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return g
 }
 
 func ShowOption(options []string, title ...string) (string, error) {
-	if len(options) == 0 {
+	return ShowChoice(options, options, title...)
+}
+
+// ShowChoice shows labels and returns the key of the selected one
+func ShowChoice(keys []string, labels []string, title ...string) (string, error) {
+	if len(labels) == 0 {
 		return "", fmt.Errorf("no options provided")
 	}
+	if len(keys) != len(labels) {
+		return "", fmt.Errorf("%d keys for %d options", len(keys), len(labels))
+	}
 
 	initialModel := model{
-		choices: options,
+		choices: labels,
+		keys:    keys,
 		title:   "Choose an option:",
 	}
 
@@ -201,7 +262,7 @@ func ShowOption(options []string, title ...string) (string, error) {
 		return "", fmt.Errorf("unexpected model type")
 	}
 
-	if modelInstance.selected == "" {
+	if !modelInstance.done {
 		return "", fmt.Errorf("no option selected")
 	}
 
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"anybakup/util"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchDebounce time.Duration
+	watchInclude  []string
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Back up tracked files automatically when they change",
+	Long: `Watch every tracked file and directory and back it up once it has stopped changing for the --debounce period.
+The debounce period (watch.quiet) and the include list default to the watch section of the profile in config.yaml:
+
+  profile:
+    home:
+      repodir: /backup/home
+      watch:
+        quiet: 5s
+        include: [/home/me/.config, "/home/me/.*rc"]
+
+Paths added to the repository while watching are picked up without a restart.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		g := profileGitCmd()
+		w := NewWatcher(*g)
+		if cmd.Flags().Changed("debounce") {
+			w.Quiet = watchDebounce
+		}
+		if len(watchInclude) > 0 {
+			w.Include = watchInclude
+		}
+		w.OnBackup = func(ret Result_git_add) {
+			if ret.Err != nil {
+				logrus.Errorf("Error add file %v: [%v]", ret.Src, ret.Err)
+			} else if ret.Result != util.GitResultTypeNochange {
+				fmt.Printf("%s %s backup %s\n", time.Now().Format(time.DateTime), ret.Src, ret.Result)
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		logrus.Infof("watching %s, debounce %v", g.C.RepoDir, w.Quiet)
+		if err := w.Run(ctx); err != nil {
+			fatalf("Error watch: [%v]", err)
+		}
+	},
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", DefaultWatchQuiet, "back up a path once it has not changed for this long")
+	watchCmd.Flags().StringSliceVar(&watchInclude, "include", nil, "only watch tracked paths matching these globs or below these directories")
+	rootCmd.AddCommand(watchCmd)
+}
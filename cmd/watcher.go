@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultWatchQuiet is the quiet period used when none is configured
+const DefaultWatchQuiet = 2 * time.Second
+
+// Watcher backs up tracked paths when they change on disk. Events are
+// debounced per tracked path: a path is backed up once it has been quiet for
+// Quiet. Paths tracked after the watcher started are picked up as soon as
+// the operation log is written.
+type Watcher struct {
+	g        GitCmd
+	Quiet    time.Duration
+	Include  []string
+	OnBackup func(Result_git_add)
+	// OnReady is called by Run once the tracked paths are watched
+	OnReady func()
+	// OnReload is called with the watched tracked paths after every reload
+	OnReload func(roots []FileOperation)
+
+	fw      *fsnotify.Watcher
+	dbfile  string
+	roots   []FileOperation
+	dirs    map[string]bool
+	pending map[string]time.Time
+	// stale is set while a reload has failed and must be retried
+	stale bool
+}
+
+// NewWatcher creates a Watcher using the watch settings of g's config
+func NewWatcher(g GitCmd) *Watcher {
+	w := &Watcher{
+		g:       g,
+		Quiet:   g.C.Watch.Quiet,
+		Include: g.C.Watch.Include,
+		dbfile:  filepath.Join(g.C.RepoDir.String(), "file_operations.db"),
+		pending: map[string]time.Time{},
+	}
+	if w.Quiet <= 0 {
+		w.Quiet = DefaultWatchQuiet
+	}
+	return w
+}
+
+// included reports whether src matches the include list
+func (w *Watcher) included(src string) bool {
+	if len(w.Include) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(w.Include, func(pattern string) bool {
+		if ok, _ := filepath.Match(pattern, src); ok {
+			return true
+		}
+		return src == pattern || isUnder(src, pattern)
+	})
+}
+
+// reload re-reads the tracked paths and updates the set of watched directories
+func (w *Watcher) reload() error {
+	ops, err := GetAllOpt(w.g.C)
+	if err != nil {
+		return err
+	}
+	w.roots = w.roots[:0]
+	dirs := map[string]bool{filepath.Dir(w.dbfile): true}
+	for _, op := range ops {
+		if isCovered(ops, op.SrcFile) || !w.included(op.SrcFile) {
+			continue
+		}
+		w.roots = append(w.roots, op)
+		if op.IsFile {
+			dirs[filepath.Dir(op.SrcFile)] = true
+			continue
+		}
+		filepath.WalkDir(op.SrcFile, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				dirs[path] = true
+			}
+			return nil
+		})
+	}
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			w.fw.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+	for dir := range dirs {
+		w.watchDir(dir)
+	}
+	if w.OnReload != nil {
+		w.OnReload(slices.Clone(w.roots))
+	}
+	return nil
+}
+
+// tryReload reloads the tracked paths. A failed reload, e.g. while the
+// process adding a path still holds the database lock, is retried on the
+// next tick until it succeeds.
+func (w *Watcher) tryReload() {
+	if err := w.reload(); err != nil {
+		logrus.Debugf("watch reload: %v", err)
+		w.stale = true
+		return
+	}
+	w.stale = false
+}
+
+func (w *Watcher) watchDir(dir string) {
+	if w.dirs[dir] {
+		return
+	}
+	if err := w.fw.Add(dir); err != nil {
+		logrus.Warnf("watch %v: %v", dir, err)
+		return
+	}
+	w.dirs[dir] = true
+}
+
+// rootOf returns the tracked path an event on name belongs to
+func (w *Watcher) rootOf(name string) (FileOperation, bool) {
+	for _, op := range w.roots {
+		if name == op.SrcFile || (!op.IsFile && isUnder(name, op.SrcFile)) {
+			return op, true
+		}
+	}
+	return FileOperation{}, false
+}
+
+func (w *Watcher) handle(e fsnotify.Event) {
+	if strings.HasPrefix(e.Name, w.dbfile) {
+		w.tryReload()
+		return
+	}
+	op, ok := w.rootOf(e.Name)
+	if !ok {
+		return
+	}
+	if e.Has(fsnotify.Create) && !op.IsFile {
+		if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+			filepath.WalkDir(e.Name, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && d.IsDir() {
+					w.watchDir(path)
+				}
+				return nil
+			})
+		}
+	}
+	w.pending[op.SrcFile] = time.Now()
+}
+
+// flush backs up every pending path that has been quiet long enough
+func (w *Watcher) flush() {
+	for src, last := range w.pending {
+		if time.Since(last) < w.Quiet {
+			continue
+		}
+		delete(w.pending, src)
+		op, ok := w.rootOf(src)
+		if !ok {
+			continue
+		}
+		if _, err := os.Lstat(src); err != nil {
+			continue
+		}
+		tag := []string{}
+		if op.Tag != "" {
+			tag = append(tag, op.Tag)
+		}
+		ret := w.g.AddFile(src, tag...)
+		if w.OnBackup != nil {
+			w.OnBackup(ret)
+		}
+	}
+}
+
+// Run watches until ctx is done
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch: %v", err)
+	}
+	defer fw.Close()
+	w.fw = fw
+	w.dirs = map[string]bool{}
+	if err := w.reload(); err != nil {
+		return err
+	}
+	if w.OnReady != nil {
+		w.OnReady()
+	}
+	ticker := time.NewTicker(max(w.Quiet/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(e)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			logrus.Warnf("watch: %v", err)
+		case <-ticker.C:
+			if w.stale {
+				w.tryReload()
+			}
+			w.flush()
+		}
+	}
+}
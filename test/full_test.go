@@ -35,12 +35,12 @@ func setupTestEnv(t *testing.T) (ret cmd.GitCmd, cleanup func()) {
 		t.Fatalf("Failed to write config file: %v", err)
 	}
 
-	// Set HOME to temp directory so config is loaded from there
-	oldHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
+	// Point the config lookup at the temp config file
+	oldConfig := os.Getenv("ANYBAKUP_CONFIG")
+	os.Setenv("ANYBAKUP_CONFIG", configFile)
 
 	cleanup = func() {
-		os.Setenv("HOME", oldHome)
+		os.Setenv("ANYBAKUP_CONFIG", oldConfig)
 		os.RemoveAll(tmpDir)
 	}
 	re := cmd.GitCmd{C: &util.Config{RepoDir: util.RepoRoot(repoDir)}}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// atLayouts are the timestamp formats accepted for --at, in local time
+var atLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// agoPattern matches relative times such as "3d", "2h", "1w" or "3 days ago"
+var agoPattern = regexp.MustCompile(`^(\d+)\s*(s|sec|secs|seconds?|m|min|mins|minutes?|h|hours?|d|days?|w|weeks?)(\s+ago)?$`)
+
+// ParseAt parses a point in time given on the command line.
+// Besides absolute timestamps it accepts "now", "today [15:04]",
+// "yesterday [15:04]", a bare "15:04" for today and relative times like
+// "3d", "12h" or "2 weeks ago".
+func ParseAt(s string) (time.Time, error) {
+	return parseAtFrom(s, time.Now())
+}
+
+// ParseSince parses the start of a time range. It accepts the same forms as
+// ParseAt, but a bare date, "today" or "yesterday" means the start of that
+// day instead of its end.
+func ParseSince(s string) (time.Time, error) {
+	return parseSinceFrom(s, time.Now())
+}
+
+func parseAtFrom(s string, now time.Time) (time.Time, error) {
+	return parseTime(s, now, false)
+}
+
+func parseSinceFrom(s string, now time.Time) (time.Time, error) {
+	return parseTime(s, now, true)
+}
+
+// parseTime parses s relative to now; days without a clock resolve to their
+// start when since is set and to their end otherwise
+func parseTime(s string, now time.Time, since bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	// layouts are matched case sensitively for the T and Z of RFC 3339
+	for _, layout := range atLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			if layout == "2006-01-02" && !since {
+				// a bare date means the state at the end of that day
+				t = endOfDay(t)
+			}
+			return t, nil
+		}
+	}
+	s = strings.ToLower(s)
+	if s == "now" {
+		return now, nil
+	}
+	if m := agoPattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := time.Second
+		switch m[2][0] {
+		case 'm':
+			unit = time.Minute
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		}
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+	day, clock, _ := strings.Cut(s, " ")
+	switch day {
+	case "today", "yesterday":
+		base := now
+		if day == "yesterday" {
+			base = now.AddDate(0, 0, -1)
+		}
+		if clock == "" {
+			if since {
+				return startOfDay(base), nil
+			}
+			if day == "today" {
+				return now, nil
+			}
+			return endOfDay(base), nil
+		}
+		return atClock(base, clock)
+	}
+	if t, err := atClock(now, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func endOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 23, 59, 59, 0, t.Location())
+}
+
+// atClock returns the day of base at the given "15:04" or "15:04:05"
+func atClock(base time.Time, clock string) (time.Time, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if c, err := time.Parse(layout, clock); err == nil {
+			y, m, d := base.Date()
+			return time.Date(y, m, d, c.Hour(), c.Minute(), c.Second(), 0, base.Location()), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", clock)
+}
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAt(t *testing.T) {
+	at, err := ParseAt("2026-09-01 12:00")
+	if err != nil {
+		t.Fatalf("ParseAt failed: %v", err)
+	}
+	if want := time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local); !at.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, at)
+	}
+	if at, err := ParseAt("2026-09-01"); err != nil || at.Hour() != 23 {
+		t.Errorf("Expected end of day, got %v %v", at, err)
+	}
+	if _, err := ParseAt("abc123"); err == nil {
+		t.Error("Expected error for a commit hash")
+	}
+
+	now := time.Date(2026, 10, 17, 9, 30, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"now":             now,
+		"3d":              now.AddDate(0, 0, -3),
+		"12h":             now.Add(-12 * time.Hour),
+		"2 weeks ago":     now.AddDate(0, 0, -14),
+		"30 min ago":      now.Add(-30 * time.Minute),
+		"yesterday 18:00": time.Date(2026, 10, 16, 18, 0, 0, 0, time.Local),
+		"yesterday":       time.Date(2026, 10, 16, 23, 59, 59, 0, time.Local),
+		"today 08:15":     time.Date(2026, 10, 17, 8, 15, 0, 0, time.Local),
+		"07:00":           time.Date(2026, 10, 17, 7, 0, 0, 0, time.Local),
+		"Yesterday 18:00": time.Date(2026, 10, 16, 18, 0, 0, 0, time.Local),
+		// one case per entry of atLayouts
+		"2026-09-01T12:00:05Z":      time.Date(2026, 9, 1, 12, 0, 5, 0, time.UTC),
+		"2026-09-01T12:00:05+02:00": time.Date(2026, 9, 1, 10, 0, 5, 0, time.UTC),
+		"2026-09-01 12:00:05":       time.Date(2026, 9, 1, 12, 0, 5, 0, time.Local),
+		"2026-09-01 12:00":          time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local),
+		"2026-09-01T12:00:05":       time.Date(2026, 9, 1, 12, 0, 5, 0, time.Local),
+		"2026-09-01T12:00":          time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local),
+		"2026-09-01":                time.Date(2026, 9, 1, 23, 59, 59, 0, time.Local),
+	}
+	for in, want := range tests {
+		if got, err := parseAtFrom(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseAtFrom(%q) = %v %v, want %v", in, got, err, want)
+		}
+	}
+
+	// a day that is 23 hours long still ends at 23:59:59
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	want := time.Date(2025, 3, 30, 23, 59, 59, 0, berlin)
+	if got, err := parseAtFrom("2025-03-30", now.In(berlin)); err != nil || !got.Equal(want) {
+		t.Errorf("parseAtFrom on a DST day = %v %v, want %v", got, err, want)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 17, 9, 30, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"2026-09-01":       time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local),
+		"2026-09-01 12:00": time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local),
+		"today":            time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local),
+		"yesterday":        time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local),
+		"yesterday 18:00":  time.Date(2026, 10, 16, 18, 0, 0, 0, time.Local),
+		"3d":               now.AddDate(0, 0, -3),
+	}
+	for in, want := range tests {
+		if got, err := parseSinceFrom(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseSinceFrom(%q) = %v %v, want %v", in, got, err, want)
+		}
+	}
+}
@@ -1,25 +1,146 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"go.yaml.in/yaml/v3"
 )
 
+// WatchConfig controls `anybakup watch`
+type WatchConfig struct {
+	// Quiet is how long a path must stay unchanged before it is backed up
+	Quiet time.Duration `yaml:"quiet,omitempty" json:"quiet,omitempty"`
+	// Include limits watching to tracked paths matching these globs or below
+	// these directories; empty watches everything tracked
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+}
+
+// Author is the author of backup commits
+type Author struct {
+	Name  string `yaml:"name,omitempty" json:"name,omitempty"`
+	Email string `yaml:"email,omitempty" json:"email,omitempty"`
+}
+
+// Remote is a git remote backups are pushed to
+type Remote struct {
+	URL string `yaml:"url" json:"url"`
+	// AutoPush pushes after every backup commit
+	AutoPush bool `yaml:"auto_push,omitempty" json:"auto_push,omitempty"`
+}
+
+// Settings are the options set globally and overridden per profile
+type Settings struct {
+	Watch WatchConfig `yaml:"watch,omitempty" json:"watch"`
+	// Exclude holds gitignore-style rules skipped in directory backups
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// Symlinks is the symlink policy: follow (default), preserve or skip
+	Symlinks string `yaml:"symlinks,omitempty" json:"symlinks,omitempty"`
+	Author   Author `yaml:"author,omitempty" json:"author"`
+	// MaxSize skips larger files in directory backups, zero means no limit
+	MaxSize    ByteSize          `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	DefaultTag string            `yaml:"default_tag,omitempty" json:"default_tag,omitempty"`
+	Remotes    map[string]Remote `yaml:"remotes,omitempty" json:"remotes,omitempty"`
+}
+
 type Profile struct {
-	RepoDir RepoRoot `yaml:"repodir"`
+	RepoDir  RepoRoot `yaml:"repodir" json:"repodir"`
+	Settings `yaml:",inline"`
 }
 type Config struct {
-	RepoDir RepoRoot           `yaml:"repodir"`
-	Profile map[string]Profile `yaml:"profile"`
-	Default string
+	RepoDir  RepoRoot           `yaml:"repodir"`
+	Profile  map[string]Profile `yaml:"profile"`
+	Default  string
+	Settings `yaml:",inline"`
+	// LogLevel is the logrus level: trace, debug, info (default), warn or error
+	LogLevel string `yaml:"log_level,omitempty"`
+	// path is the config file, empty for the default one
+	path string
+}
+
+// over returns s with its unset values taken from base. Exclude rules and
+// remotes of both are combined.
+func (s Settings) over(base Settings) Settings {
+	ret := s
+	if ret.Watch.Quiet == 0 {
+		ret.Watch.Quiet = base.Watch.Quiet
+	}
+	if len(ret.Watch.Include) == 0 {
+		ret.Watch.Include = base.Watch.Include
+	}
+	ret.Exclude = append(slices.Clone(base.Exclude), s.Exclude...)
+	if ret.Symlinks == "" {
+		ret.Symlinks = base.Symlinks
+	}
+	if ret.Author.Name == "" {
+		ret.Author.Name = base.Author.Name
+	}
+	if ret.Author.Email == "" {
+		ret.Author.Email = base.Author.Email
+	}
+	if ret.MaxSize == 0 {
+		ret.MaxSize = base.MaxSize
+	}
+	if ret.DefaultTag == "" {
+		ret.DefaultTag = base.DefaultTag
+	}
+	if len(base.Remotes) > 0 {
+		ret.Remotes = maps.Clone(base.Remotes)
+		maps.Copy(ret.Remotes, s.Remotes)
+	}
+	return ret
 }
 
-func (c *Config) Printf() {
-	panic("unimplemented")
+// validate checks the values of s
+func (s Settings) validate() error {
+	if _, err := ParseSymlinkPolicy(s.Symlinks); err != nil {
+		return fmt.Errorf("symlinks: %v", err)
+	}
+	if s.Watch.Quiet < 0 {
+		return fmt.Errorf("watch.quiet must not be negative")
+	}
+	if s.MaxSize < 0 {
+		return fmt.Errorf("max_size must not be negative")
+	}
+	if s.Author.Email != "" && !strings.Contains(s.Author.Email, "@") {
+		return fmt.Errorf("author.email %q is not an email address", s.Author.Email)
+	}
+	for name, r := range s.Remotes {
+		if name == "" || r.URL == "" {
+			return fmt.Errorf("remote %q needs a name and a url", name)
+		}
+	}
+	return nil
+}
+
+// Validate checks the global settings and every profile
+func (c *Config) Validate() error {
+	if c.LogLevel != "" {
+		if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+			return fmt.Errorf("log_level: %v", err)
+		}
+	}
+	if err := c.Settings.validate(); err != nil {
+		return err
+	}
+	for _, name := range c.ProfileNames() {
+		p := c.Profile[name]
+		if p.RepoDir == "" {
+			return fmt.Errorf("profile %v: repodir is missing", name)
+		}
+		if err := p.Settings.validate(); err != nil {
+			return fmt.Errorf("profile %v: %v", name, err)
+		}
+	}
+	return nil
 }
 
 func (r RepoRoot) String() string {
@@ -53,15 +174,29 @@ func (c *Config) SetProfile(name string, p Profile) error {
 	return c.Save()
 }
 
+// AddProfile adds or replaces a profile and saves the config. The profile
+// becomes the default with makeDefault or when there is no default yet.
+func (c *Config) AddProfile(name string, p Profile, makeDefault bool) error {
+	if c.Profile == nil {
+		c.Profile = make(map[string]Profile)
+	}
+	c.Profile[name] = p
+	if makeDefault || c.Default == "" {
+		c.Default = name
+		c.RepoDir = p.RepoDir
+	}
+	return c.Save()
+}
+
 func (c *Config) GetProfile(name string) *Config {
-	logrus.Printf("GetProfile [%v]", name)
+	logrus.Debugf("GetProfile [%v]", name)
 	if name == "" {
 		name = "default"
 	}
 	if p, ok := c.Profile[name]; ok {
-		return &Config{RepoDir: p.RepoDir}
+		return &Config{RepoDir: p.RepoDir, Settings: p.Settings.over(c.Settings), LogLevel: c.LogLevel, path: c.path}
 	}
-	logrus.Printf("GetProfile [%v] is nil", name)
+	logrus.Debugf("GetProfile [%v] is nil", name)
 	return nil
 }
 
@@ -82,29 +217,94 @@ func (c *Config) Load() error {
 		return fmt.Errorf("error getting config file path: %v", err)
 	}
 	b, err := os.ReadFile(configFilePath)
+	if os.IsNotExist(err) {
+		// no config yet, init creates it
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("error reading config file: %v", err)
 	}
-	return yaml.Unmarshal(b, c)
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("error parsing config file %v: %v", configFilePath, err)
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid config file %v: %v", configFilePath, err)
+	}
+	return nil
 }
 
-func (c *Config) configfile() (string, error) {
-	configDir, err := c.Configdir()
+// configFile overrides the default config file, see SetConfigFile
+var configFile string
+
+// SetConfigFile makes every Config not loaded with LoadConfig use file.
+// An empty file restores the default lookup.
+func SetConfigFile(file string) {
+	configFile = file
+}
+
+// ConfigFile returns the default config file: the one set with
+// SetConfigFile, $ANYBAKUP_CONFIG, $XDG_CONFIG_HOME/anybakup/config.yaml or
+// ~/.config/anybakup/config.yaml
+func ConfigFile() (string, error) {
+	if configFile != "" {
+		return filepath.Abs(configFile)
+	}
+	if env := os.Getenv("ANYBAKUP_CONFIG"); env != "" {
+		return filepath.Abs(env)
+	}
+	// relative values are invalid per the XDG spec and ignored
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "anybakup", "config.yaml"), nil
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("error getting home directory: %v", err)
 	}
-	// c.RepoDir = dir
-	configFilePath := filepath.Join(configDir, "config.yaml")
-	return configFilePath, nil
+	return filepath.Join(home, ".config", "anybakup", "config.yaml"), nil
 }
 
-func (Config) Configdir() (string, error) {
+// DataDir returns the directory holding cloned backup repositories:
+// $XDG_DATA_HOME/anybakup or ~/.local/share/anybakup
+func DataDir() (string, error) {
+	if xdg := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "anybakup"), nil
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("error getting home directory: %v", err)
 	}
+	return filepath.Join(home, ".local", "share", "anybakup"), nil
+}
+
+// LoadConfig loads the config file at path; Save writes back to the same file
+func LoadConfig(path string) (*Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{path: abs}
+	if err := c.Load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) configfile() (string, error) {
+	if c.path != "" {
+		return c.path, nil
+	}
+	return ConfigFile()
+}
 
-	configDir := filepath.Join(home, ".config", "anybakup")
+// Configdir returns the directory of the config file, creating it
+func (c Config) Configdir() (string, error) {
+	file, err := c.configfile()
+	if err != nil {
+		return "", err
+	}
+	configDir := filepath.Dir(file)
 	if err := os.MkdirAll(configDir, 0o755); err != nil {
 		return "", fmt.Errorf("error creating config directory: %v", err)
 	}
@@ -116,6 +316,9 @@ func (c *Config) Save() error {
 	if err != nil {
 		return fmt.Errorf("error getting config file path: %v", err)
 	}
+	if _, err := c.Configdir(); err != nil {
+		return err
+	}
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("error marshaling config: %v", err)
@@ -125,3 +328,194 @@ func (c *Config) Save() error {
 	}
 	return nil
 }
+
+// ProfileNames returns the profile names in sorted order
+func (c *Config) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(c.Profile))
+}
+
+// profile returns the named profile or an error if it does not exist
+func (c *Config) profile(name string) (Profile, error) {
+	p, ok := c.Profile[name]
+	if !ok {
+		return p, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// UseProfile makes name the default profile and saves the config
+func (c *Config) UseProfile(name string) error {
+	p, err := c.profile(name)
+	if err != nil {
+		return err
+	}
+	c.Default = name
+	c.RepoDir = p.RepoDir
+	return c.Save()
+}
+
+// RemoveProfile deletes a profile and saves the config. Removing the default
+// profile leaves no default.
+func (c *Config) RemoveProfile(name string) (Profile, error) {
+	p, err := c.profile(name)
+	if err != nil {
+		return p, err
+	}
+	delete(c.Profile, name)
+	if c.Default == name {
+		c.Default = ""
+		c.RepoDir = ""
+	}
+	return p, c.Save()
+}
+
+// RenameProfile renames a profile and saves the config
+func (c *Config) RenameProfile(from, to string) error {
+	p, err := c.profile(from)
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		return fmt.Errorf("empty profile name")
+	}
+	if _, ok := c.Profile[to]; ok {
+		return fmt.Errorf("profile %q already exists", to)
+	}
+	delete(c.Profile, from)
+	c.Profile[to] = p
+	if c.Default == from {
+		c.Default = to
+	}
+	return c.Save()
+}
+
+// ProfileKeys lists the keys accepted by SetProfileValue
+var ProfileKeys = []string{"repodir", "exclude", "symlinks", "watch.quiet", "watch.include",
+	"author.name", "author.email", "max_size", "default_tag"}
+
+// SetProfileValue sets one key of a profile, creating the profile if it does
+// not exist, and saves the config. List values are comma separated; an empty
+// value clears the key.
+func (c *Config) SetProfileValue(name, key, value string) error {
+	if name == "" {
+		return fmt.Errorf("empty profile name")
+	}
+	p := c.Profile[name]
+	var list []string
+	if value != "" {
+		list = strings.Split(value, ",")
+	}
+	switch key {
+	case "repodir":
+		if value == "" {
+			return fmt.Errorf("repodir must not be empty")
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return err
+		}
+		p.RepoDir = RepoRoot(abs)
+	case "exclude":
+		p.Exclude = list
+	case "symlinks":
+		p.Symlinks = value
+	case "watch.quiet":
+		var quiet time.Duration
+		if value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("watch.quiet: %v", err)
+			}
+			quiet = d
+		}
+		p.Watch.Quiet = quiet
+	case "watch.include":
+		p.Watch.Include = list
+	case "author.name":
+		p.Author.Name = value
+	case "author.email":
+		p.Author.Email = value
+	case "max_size":
+		size, err := ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("max_size: %v", err)
+		}
+		p.MaxSize = size
+	case "default_tag":
+		p.DefaultTag = value
+	default:
+		return fmt.Errorf("unknown profile key %q, use one of %v", key, strings.Join(ProfileKeys, ", "))
+	}
+	if p.RepoDir == "" {
+		return fmt.Errorf("profile %q has no repodir, set it first", name)
+	}
+	if err := p.Settings.validate(); err != nil {
+		return err
+	}
+	if c.Profile == nil {
+		c.Profile = make(map[string]Profile)
+	}
+	c.Profile[name] = p
+	if c.Default == name {
+		c.RepoDir = p.RepoDir
+	}
+	return c.Save()
+}
+
+// SetRemote adds or replaces a remote of a profile and saves the config. An
+// empty profile name changes the global remotes.
+func (c *Config) SetRemote(profile, name string, r Remote) error {
+	if name == "" || r.URL == "" {
+		return fmt.Errorf("remote needs a name and a url")
+	}
+	return c.updateSettings(profile, func(s *Settings) error {
+		s.Remotes = maps.Clone(s.Remotes)
+		if s.Remotes == nil {
+			s.Remotes = make(map[string]Remote)
+		}
+		s.Remotes[name] = r
+		return nil
+	})
+}
+
+// RemoveRemote deletes a remote of a profile and saves the config. An empty
+// profile name changes the global remotes.
+func (c *Config) RemoveRemote(profile, name string) error {
+	return c.updateSettings(profile, func(s *Settings) error {
+		if _, ok := s.Remotes[name]; !ok {
+			if _, ok := c.Remotes[name]; ok && profile != "" {
+				return fmt.Errorf("remote %q is global", name)
+			}
+			return fmt.Errorf("unknown remote %q", name)
+		}
+		s.Remotes = maps.Clone(s.Remotes)
+		delete(s.Remotes, name)
+		return nil
+	})
+}
+
+// updateSettings applies fn to the settings of a profile, or to the global
+// settings for an empty name, then validates and saves the config
+func (c *Config) updateSettings(profile string, fn func(*Settings) error) error {
+	if profile == "" {
+		if err := fn(&c.Settings); err != nil {
+			return err
+		}
+		if err := c.Settings.validate(); err != nil {
+			return err
+		}
+		return c.Save()
+	}
+	p, err := c.profile(profile)
+	if err != nil {
+		return err
+	}
+	if err := fn(&p.Settings); err != nil {
+		return err
+	}
+	if err := p.Settings.validate(); err != nil {
+		return err
+	}
+	c.Profile[profile] = p
+	return c.Save()
+}
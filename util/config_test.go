@@ -0,0 +1,245 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestProfileManagement(t *testing.T) {
+	t.Setenv("ANYBAKUP_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	c := &Config{}
+	for _, name := range []string{"work", "home"} {
+		if err := c.SetProfile(name, Profile{RepoDir: RepoRoot("/" + name)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := c.ProfileNames(); !slices.Equal(names, []string{"home", "work"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+	if err := c.UseProfile("work"); err != nil || c.Default != "work" || c.RepoDir != "/work" {
+		t.Errorf("use failed: %v %+v", err, c)
+	}
+	if err := c.UseProfile("nope"); err == nil {
+		t.Error("expected using an unknown profile to fail")
+	}
+	if err := c.RenameProfile("work", "home"); err == nil {
+		t.Error("expected renaming onto an existing profile to fail")
+	}
+	if err := c.RenameProfile("work", "office"); err != nil || c.Default != "office" {
+		t.Errorf("rename failed: %v %+v", err, c)
+	}
+
+	if err := c.SetProfileValue("office", "exclude", "*.o,node_modules/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetProfileValue("office", "watch.quiet", "5s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetProfileValue("office", "max_size", "1M"); err != nil || c.Profile["office"].MaxSize != 1<<20 {
+		t.Errorf("max_size not set: %v %+v", err, c.Profile["office"])
+	}
+	for _, bad := range [][2]string{{"symlinks", "sometimes"}, {"watch.quiet", "soon"}, {"colour", "red"},
+		{"max_size", "huge"}, {"author.email", "nobody"}} {
+		if err := c.SetProfileValue("office", bad[0], bad[1]); err == nil {
+			t.Errorf("expected %v=%v to fail", bad[0], bad[1])
+		}
+	}
+	if err := c.SetProfileValue("new", "symlinks", "skip"); err == nil {
+		t.Error("expected a new profile without repodir to fail")
+	}
+
+	loaded := &Config{}
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	p := loaded.Profile["office"]
+	if !slices.Equal(p.Exclude, []string{"*.o", "node_modules/"}) || p.Watch.Quiet != 5*time.Second || p.RepoDir != "/work" {
+		t.Errorf("unexpected saved profile %+v", p)
+	}
+
+	if _, err := loaded.RemoveProfile("office"); err != nil || loaded.Default != "" || loaded.RepoDir != "" {
+		t.Errorf("remove failed: %v %+v", err, loaded)
+	}
+	if _, err := loaded.RemoveProfile("office"); err == nil {
+		t.Error("expected removing a missing profile to fail")
+	}
+}
+
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("ANYBAKUP_CONFIG", file)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigLoadValidates(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown key":        "repodir: /r\nrepo_dir: /r\n",
+		"unknown profile":    "profile:\n  work:\n    repodir: /w\n    colour: red\n",
+		"symlinks":           "symlinks: sometimes\n",
+		"max_size":           "profile:\n  work:\n    repodir: /w\n    max_size: huge\n",
+		"email":              "author:\n  email: nobody\n",
+		"missing repodir":    "profile:\n  work:\n    exclude: ['*.o']\n",
+		"remote without url": "remotes:\n  origin:\n    auto_push: true\n",
+		"log_level":          "log_level: loud\n",
+		"retention":          "profile:\n  work:\n    repodir: /w\n    retention:\n      keep_last: 5\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			writeConfig(t, content)
+			if err := (&Config{}).Load(); err == nil {
+				t.Errorf("expected %q to be rejected", content)
+			}
+		})
+	}
+}
+
+func TestGetProfileMerge(t *testing.T) {
+	writeConfig(t, `repodir: /r
+exclude: ['*.o']
+author:
+  name: backup
+  email: backup@example.com
+max_size: 10MB
+default_tag: daily
+remotes:
+  origin:
+    url: /srv/origin.git
+profile:
+  work:
+    repodir: /w
+    exclude: [node_modules/]
+    author:
+      email: work@example.com
+    remotes:
+      mirror:
+        url: /srv/mirror.git
+        auto_push: true
+`)
+	c := &Config{}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	p := c.GetProfile("work")
+	want := Settings{
+		Exclude:    []string{"*.o", "node_modules/"},
+		Author:     Author{Name: "backup", Email: "work@example.com"},
+		MaxSize:    10 << 20,
+		DefaultTag: "daily",
+		Remotes: map[string]Remote{
+			"origin": {URL: "/srv/origin.git"},
+			"mirror": {URL: "/srv/mirror.git", AutoPush: true},
+		},
+	}
+	if p.RepoDir != "/w" || !reflect.DeepEqual(p.Settings, want) {
+		t.Errorf("unexpected merged profile %+v", p)
+	}
+	if len(c.Remotes) != 1 {
+		t.Errorf("merging changed the global remotes: %v", c.Remotes)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved := &Config{}
+	if err := saved.Load(); err != nil || saved.MaxSize != 10<<20 {
+		t.Errorf("expected the config to survive a save, got %v %v", saved.MaxSize, err)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for in, want := range map[string]ByteSize{"": 0, "512": 512, "64K": 64 << 10, "10MB": 10 << 20, "1GiB": 1 << 30, "1.5k": 1536, "2t": 2 << 40} {
+		if got, err := ParseByteSize(in); err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %v %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"huge", "-1M", "1X"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Errorf("expected %q to fail", in)
+		}
+	}
+	if s := ByteSize(10 << 20).String(); s != "10M" {
+		t.Errorf("unexpected string %v", s)
+	}
+}
+
+func TestAuthorAndMaxSize(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	c.Author = Author{Name: "backup", Email: "backup@example.com"}
+	c.MaxSize = 8
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcDir := t.TempDir()
+	for name, content := range map[string]string{"small": "tiny", "big": "larger than eight"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.CopyToRepo(SrcPath(filepath.Join(srcDir, "big"))); err == nil {
+		t.Error("expected adding a file above max_size to fail")
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(gitpath.ToAbs(*r), "big")); !os.IsNotExist(err) {
+		t.Errorf("expected big to be skipped, got %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatal(err)
+	}
+	if modified, err := r.GitSrcModified(SrcPath(srcDir)); err != nil || modified {
+		t.Errorf("expected skipped files not to count as changes, got %v %v", modified, err)
+	}
+	logs, err := r.GitLogPath(gitpath)
+	if err != nil || len(logs) != 1 || logs[0].Author != "backup" {
+		t.Errorf("unexpected log %v %v", logs, err)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	defer SetConfigFile("")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ANYBAKUP_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	check := func(want string) {
+		t.Helper()
+		if got, err := ConfigFile(); err != nil || got != want {
+			t.Errorf("ConfigFile() = %v %v, want %v", got, err, want)
+		}
+	}
+	check(filepath.Join(home, ".config", "anybakup", "config.yaml"))
+	t.Setenv("XDG_CONFIG_HOME", "relative")
+	check(filepath.Join(home, ".config", "anybakup", "config.yaml"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	check(filepath.Join(home, "xdg", "anybakup", "config.yaml"))
+	t.Setenv("ANYBAKUP_CONFIG", filepath.Join(home, "env.yaml"))
+	check(filepath.Join(home, "env.yaml"))
+	SetConfigFile(filepath.Join(home, "flag.yaml"))
+	check(filepath.Join(home, "flag.yaml"))
+
+	// an explicit path wins over the lookup and is written back by Save
+	explicit := filepath.Join(home, "app", "anybakup.yaml")
+	c, err := LoadConfig(explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetProfile("app", Profile{RepoDir: "/app"}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(explicit)
+	if err != nil || loaded.Default != "app" || loaded.GetProfile("app") == nil {
+		t.Errorf("expected the profile in %v, got %+v %v", explicit, loaded, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "flag.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected the default config to be untouched, got %v", err)
+	}
+}
@@ -1,11 +1,37 @@
 package util
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SymlinkPolicy selects how symlinks are backed up
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow backs up the file or directory a symlink points to
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkPreserve stores the symlink itself as a git symlink
+	SymlinkPreserve SymlinkPolicy = "preserve"
+	// SymlinkSkip leaves symlinks out of the backup
+	SymlinkSkip SymlinkPolicy = "skip"
 )
 
+// ParseSymlinkPolicy validates a policy name; empty means follow
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return SymlinkFollow, nil
+	case SymlinkFollow, SymlinkPreserve, SymlinkSkip:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown symlink policy %q, use follow, preserve or skip", s)
+}
+
 // CopyToRepo copies a file or directory from src (absolute path) to the repository directory,
 // preserving the full path structure.
 // For example:
@@ -19,6 +45,10 @@ func copyFile(src, dst string) error {
 	if err != nil {
 		return err
 	}
+	// Opening a fifo would block and sockets cannot be read
+	if !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("%v is not a regular file", src)
+	}
 
 	// Create destination directory if it doesn't exist
 	dstDir := filepath.Dir(dst)
@@ -33,6 +63,13 @@ func copyFile(src, dst string) error {
 	}
 	defer srcFile.Close()
 
+	// Never write through a symlink stored in the repository
+	if st, err := os.Lstat(dst); err == nil && st.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
 	// Create destination file
 	dstFile, err := os.Create(dst)
 	if err != nil {
@@ -55,11 +92,80 @@ func copyFile(src, dst string) error {
 
 // copyDir recursively copies a directory from src to dst
 func copyDir(src, dst string) error {
+	return (&copier{}).copyDir(src, dst)
+}
+
+// copier copies files and directories into the repository applying the
+// symlink policy and the exclude rules. Files that are neither regular files,
+// directories nor symlinks (fifos, sockets, devices) are skipped with a
+// warning.
+type copier struct {
+	symlinks SymlinkPolicy
+	// skip reports destination paths that must not be copied
+	skip    func(dst string, isDir bool) bool
+	maxSize ByteSize // larger files are skipped, zero means no limit
+	visited map[string]bool
+}
+
+// tooLarge reports whether a regular file exceeds MaxSize
+func (r GitRepo) tooLarge(info os.FileInfo) bool {
+	return r.MaxSize > 0 && info.Mode().IsRegular() && info.Size() > int64(r.MaxSize)
+}
+
+// copy copies src to dst according to the type of src
+func (c *copier) copy(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		switch c.symlinks {
+		case SymlinkPreserve:
+			return copySymlink(src, dst)
+		case SymlinkSkip:
+			logrus.Warnf("skip symlink %v", src)
+			return nil
+		}
+		// follow
+		if info, err = os.Stat(src); err != nil {
+			logrus.Warnf("skip dangling symlink %v: %v", src, err)
+			return nil
+		}
+	}
+	switch {
+	case info.IsDir():
+		return c.copyDir(src, dst)
+	case info.Mode().IsRegular():
+		if c.maxSize > 0 && info.Size() > int64(c.maxSize) {
+			logrus.Warnf("skip %v, larger than max_size %v", src, c.maxSize)
+			return nil
+		}
+		return copyFile(src, dst)
+	default:
+		logrus.Warnf("skip special file %v (%v)", src, info.Mode().Type())
+		return nil
+	}
+}
+
+// copyDir recursively copies a directory from src to dst
+func (c *copier) copyDir(src, dst string) error {
 	// Get source directory info
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
+	// Guard against symlink loops when following symlinks
+	if real, err := filepath.EvalSymlinks(src); err == nil {
+		if c.visited == nil {
+			c.visited = map[string]bool{}
+		}
+		if c.visited[real] {
+			logrus.Warnf("skip symlink loop %v", src)
+			return nil
+		}
+		c.visited[real] = true
+		defer delete(c.visited, real)
+	}
 
 	// Create destination directory with same permissions
 	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
@@ -76,19 +182,75 @@ func copyDir(src, dst string) error {
 	for _, entry := range entries {
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			// Recursively copy subdirectory
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			// Copy file
-			if err := copyFile(srcPath, dstPath); err != nil {
-				return err
-			}
+		if c.skip != nil && c.skip(dstPath, entry.IsDir()) {
+			continue
+		}
+		if err := c.copy(srcPath, dstPath); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// copySymlink recreates the symlink src at dst
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := removeNonDir(dst); err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+// removeNonDir removes path unless it is missing or a directory
+func removeNonDir(path string) error {
+	if st, err := os.Lstat(path); err == nil && !st.IsDir() {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// MirrorDeletes removes the files from the repo copy of the directory src
+// that no longer exist at the source, so that the next GitAddFiles commits
+// them as deletions. It returns the removed paths.
+func (conf *GitRepo) MirrorDeletes(src SrcPath) ([]RepoPath, error) {
+	if !isDir(src.String()) {
+		return nil, nil
+	}
+	root := src.Repo()
+	dest := RepoRoot(conf.root).With(root.Sting())
+	ret := []RepoPath{}
+	err := filepath.WalkDir(dest, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dest, p)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(src.String(), rel)); !os.IsNotExist(err) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		ret = append(ret, RepoPath(filepath.Join(root.Sting(), rel)).UnixStyle())
+		return nil
+	})
+	if err != nil {
+		return ret, fmt.Errorf("mirror %v: %v", src, err)
+	}
+	return ret, nil
+}
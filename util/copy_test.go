@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -32,12 +33,12 @@ func setupTestEnv(t *testing.T) (repoDir string, cleanup func()) {
 		t.Fatalf("Failed to write config file: %v", err)
 	}
 
-	// Set HOME to temp directory so config is loaded from there
-	oldHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
+	// Point the config lookup at the temp config file
+	oldConfig := os.Getenv("ANYBAKUP_CONFIG")
+	os.Setenv("ANYBAKUP_CONFIG", configFile)
 
 	cleanup = func() {
-		os.Setenv("HOME", oldHome)
+		os.Setenv("ANYBAKUP_CONFIG", oldConfig)
 		os.RemoveAll(tmpDir)
 	}
 
@@ -349,3 +350,71 @@ func TestCopyDir(t *testing.T) {
 		t.Errorf("sub/file2.txt not copied: %v", err)
 	}
 }
+
+// TestMirrorDeletes tests that deletions at the source are committed
+func TestMirrorDeletes(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir := t.TempDir()
+	for _, name := range []string{"keep.txt", "gone.txt", "sub/gone.txt"} {
+		p := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+
+	os.Remove(filepath.Join(srcDir, "gone.txt"))
+	os.RemoveAll(filepath.Join(srcDir, "sub"))
+	if err := os.WriteFile(filepath.Join(srcDir, "keep.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := r.CopyToRepo(SrcPath(srcDir)); err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	removed, err := r.MirrorDeletes(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("MirrorDeletes failed: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("Expected 2 removed files, got %v", removed)
+	}
+	// a plain add leaves the deletions alone
+	ret, err := r.GitAddFile(gitpath)
+	if err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	if len(ret.Files) != 1 || len(ret.Deleted) != 0 {
+		t.Errorf("Expected 1 updated and no deleted files, got %v %v", ret.Files, ret.Deleted)
+	}
+	ret, err = r.GitAddFiles([]RepoPath{gitpath}, true)
+	if err != nil {
+		t.Fatalf("GitAddFiles failed: %v", err)
+	}
+	if len(ret.Files) != 0 || len(ret.Deleted) != 2 {
+		t.Errorf("Expected 2 deleted files, got %v %v", ret.Files, ret.Deleted)
+	}
+	logs, err := r.GitLogPath(gitpath)
+	if err != nil {
+		t.Fatalf("GitLogPath failed: %v", err)
+	}
+	if len(logs) != 3 || !strings.Contains(logs[0].Message, "RM "+gitpath.UnixStyle().Sting()+"/gone.txt") {
+		t.Errorf("Expected a commit recording the deletions, got %v", logs)
+	}
+	if _, err := r.GitExportTree(gitpath, "", t.TempDir()); err != nil {
+		t.Fatalf("GitExportTree failed: %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/utils/binary"
+	"github.com/go-git/go-git/v6/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DefaultDiffContext is the number of context lines shown around each hunk,
+// the same default as `git diff`.
+const DefaultDiffContext = 3
+
+// DiffContent is one side of a diff. A nil *DiffContent means the file does
+// not exist on that side.
+type DiffContent struct {
+	Path string
+	Data []byte
+	Mode filemode.FileMode
+}
+
+// NewDiffContentFromFile reads a file on disk as a diff side. It returns nil
+// without error if the file does not exist.
+func NewDiffContentFromFile(path string, name string) (*DiffContent, error) {
+	st, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if st.Mode()&os.ModeSymlink != 0 {
+		// compared by link target as git does
+		link, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		return &DiffContent{Path: name, Data: []byte(link), Mode: filemode.Symlink}, nil
+	}
+	if st.IsDir() {
+		return nil, fmt.Errorf("%v is a directory", path)
+	}
+	return regularDiffContent(path, name, st)
+}
+
+func regularDiffContent(path, name string, st os.FileInfo) (*DiffContent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := filemode.NewFromOSFileMode(st.Mode())
+	if err != nil {
+		mode = filemode.Regular
+	}
+	return &DiffContent{Path: name, Data: data, Mode: mode}, nil
+}
+
+// liveContent reads a source file the way it is backed up under the symlink
+// policy: a skipped symlink reads as missing and a followed one as its target.
+func (r GitRepo) liveContent(path, name string) (*DiffContent, error) {
+	st, err := os.Lstat(path)
+	if err != nil || st.Mode()&os.ModeSymlink == 0 || r.Symlinks == SymlinkPreserve {
+		return NewDiffContentFromFile(path, name)
+	}
+	if r.Symlinks == SymlinkSkip {
+		return nil, nil
+	}
+	if st, err = os.Stat(path); err != nil || !st.Mode().IsRegular() {
+		return nil, nil
+	}
+	return regularDiffContent(path, name, st)
+}
+
+// Hash returns the git blob hash of the content
+func (d *DiffContent) Hash() plumbing.Hash {
+	h := plumbing.NewHasher(formatcfg.SHA1, plumbing.BlobObject, int64(len(d.Data)))
+	h.Write(d.Data)
+	return h.Sum()
+}
+
+type diffFile struct {
+	c *DiffContent
+}
+
+func (f diffFile) Hash() plumbing.Hash { return f.c.Hash() }
+func (f diffFile) Mode() filemode.FileMode {
+	if f.c.Mode == filemode.Empty {
+		return filemode.Regular
+	}
+	return f.c.Mode
+}
+func (f diffFile) Path() string { return f.c.Path }
+
+type diffChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c diffChunk) Content() string       { return c.content }
+func (c diffChunk) Type() fdiff.Operation { return c.op }
+
+type diffFilePatch struct {
+	from, to *DiffContent
+	binary   bool
+	chunks   []fdiff.Chunk
+}
+
+func (p diffFilePatch) IsBinary() bool        { return p.binary }
+func (p diffFilePatch) Chunks() []fdiff.Chunk { return p.chunks }
+func (p diffFilePatch) Files() (from, to fdiff.File) {
+	if p.from != nil {
+		from = diffFile{p.from}
+	}
+	if p.to != nil {
+		to = diffFile{p.to}
+	}
+	return
+}
+
+type diffPatch struct {
+	files []fdiff.FilePatch
+}
+
+func (p diffPatch) FilePatches() []fdiff.FilePatch { return p.files }
+func (p diffPatch) Message() string                { return "" }
+
+func isBinaryContent(c *DiffContent) bool {
+	if c == nil {
+		return false
+	}
+	yes, _ := binary.IsBinary(bytes.NewReader(c.Data))
+	return yes
+}
+
+func newDiffFilePatch(from, to *DiffContent) *diffFilePatch {
+	if from == nil && to == nil {
+		return nil
+	}
+	if from != nil && to != nil && (diffFile{from}).Mode() == (diffFile{to}).Mode() && bytes.Equal(from.Data, to.Data) {
+		return nil
+	}
+	p := &diffFilePatch{from: from, to: to}
+	if isBinaryContent(from) || isBinaryContent(to) {
+		p.binary = true
+		return p
+	}
+	var src, dst string
+	if from != nil {
+		src = string(from.Data)
+	}
+	if to != nil {
+		dst = string(to.Data)
+	}
+	for _, d := range diff.Do(src, dst) {
+		var op fdiff.Operation
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			op = fdiff.Equal
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		}
+		p.chunks = append(p.chunks, diffChunk{content: d.Text, op: op})
+	}
+	return p
+}
+
+// UnifiedDiffs renders line-level unified diff hunks for pairs of file
+// versions. Each pair is [from, to]; unchanged pairs are skipped.
+// Returns an empty string if nothing differs.
+func UnifiedDiffs(pairs [][2]*DiffContent, contextLines int) (string, error) {
+	if contextLines < 0 {
+		contextLines = DefaultDiffContext
+	}
+	patch := diffPatch{}
+	for _, pair := range pairs {
+		if p := newDiffFilePatch(pair[0], pair[1]); p != nil {
+			patch.files = append(patch.files, p)
+		}
+	}
+	if len(patch.files) == 0 {
+		return "", nil
+	}
+	buf := &strings.Builder{}
+	if err := fdiff.NewUnifiedEncoder(buf, contextLines).Encode(patch); err != nil {
+		return "", fmt.Errorf("unified diff %v", err)
+	}
+	return buf.String(), nil
+}
+
+// UnifiedDiff renders a unified diff between two versions of a single file.
+func UnifiedDiff(from, to *DiffContent, contextLines int) (string, error) {
+	return UnifiedDiffs([][2]*DiffContent{{from, to}}, contextLines)
+}
+
+// resolveCommit resolves a revision (full or short hash, HEAD, branch) to a commit
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %v", rev, err)
+	}
+	return commit, nil
+}
+
+// commitFileContent reads a file at the given commit. It returns nil without
+// error if the file is not part of that commit.
+func (r GitRepo) commitFileContent(commitHash string, gitpath RepoPath) (*DiffContent, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := resolveCommit(repo, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree: %v", err)
+	}
+	file, err := tree.File(gitpath.UnixStyle().Sting())
+	if err != nil {
+		if err == object.ErrFileNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("file %s in commit %s: %v", gitpath, commitHash, err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", gitpath, err)
+	}
+	return &DiffContent{Path: gitpath.UnixStyle().Sting(), Data: []byte(contents), Mode: file.Mode}, nil
+}
+
+// GitDiffCommits compares a file between two commits.
+func (r GitRepo) GitDiffCommits(gitpath RepoPath, fromCommit, toCommit string, contextLines int) (string, error) {
+	from, err := r.commitFileContent(fromCommit, gitpath)
+	if err != nil {
+		return "", fmt.Errorf("git diff %v", err)
+	}
+	to, err := r.commitFileContent(toCommit, gitpath)
+	if err != nil {
+		return "", fmt.Errorf("git diff %v", err)
+	}
+	if from == nil && to == nil {
+		return "", fmt.Errorf("git diff: %s not found in %s or %s", gitpath, fromCommit, toCommit)
+	}
+	return UnifiedDiff(from, to, contextLines)
+}
+
+// GitDiffSrc compares the backed up copy of src with the live file at src.
+// If commit is empty the copy in the repo worktree is used, otherwise the
+// version stored in that commit.
+func (r GitRepo) GitDiffSrc(src SrcPath, commit string, contextLines int) (string, error) {
+	gitpath := src.Repo().UnixStyle()
+	var from *DiffContent
+	var err error
+	if commit == "" {
+		from, err = NewDiffContentFromFile(gitpath.ToAbs(r), gitpath.Sting())
+	} else {
+		from, err = r.commitFileContent(commit, gitpath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("git diff %v", err)
+	}
+	to, err := r.liveContent(src.String(), gitpath.Sting())
+	if err != nil {
+		return "", fmt.Errorf("git diff %v", err)
+	}
+	if from == nil && to == nil {
+		return "", fmt.Errorf("git diff: %s not found in repo or at source", src)
+	}
+	return UnifiedDiff(from, to, contextLines)
+}
+
+// commitTreeContents reads every file below gitpath at the given commit,
+// keyed by repo path. gitpath may name a single file or a directory.
+func (r GitRepo) commitTreeContents(commitHash string, gitpath RepoPath) (map[string]*DiffContent, error) {
+	ret := map[string]*DiffContent{}
+	repo, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := resolveCommit(repo, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree: %v", err)
+	}
+	prefix := gitpath.UnixStyle().Sting()
+	if file, err := tree.File(prefix); err == nil {
+		contents, err := file.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", prefix, err)
+		}
+		ret[prefix] = &DiffContent{Path: prefix, Data: []byte(contents), Mode: file.Mode}
+		return ret, nil
+	}
+	subtree, err := tree.Tree(prefix)
+	if err != nil {
+		if err == object.ErrDirectoryNotFound {
+			return ret, nil
+		}
+		return nil, fmt.Errorf("tree %s in commit %s: %v", prefix, commitHash, err)
+	}
+	err = subtree.Files().ForEach(func(f *object.File) error {
+		contents, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", f.Name, err)
+		}
+		name := path.Join(prefix, f.Name)
+		ret[name] = &DiffContent{Path: name, Data: []byte(contents), Mode: f.Mode}
+		return nil
+	})
+	return ret, err
+}
+
+// srcTreeContents reads every regular file and symlink below src that is not
+// excluded, keyed by repo path.
+func (r GitRepo) srcTreeContents(src SrcPath) (map[string]*DiffContent, error) {
+	ret := map[string]*DiffContent{}
+	if _, err := os.Lstat(src.String()); os.IsNotExist(err) {
+		return ret, nil
+	}
+	root := src.String()
+	if r.Symlinks == SymlinkFollow {
+		// a followed symlinked directory is backed up under its own name
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+	}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := SrcPath(filepath.Join(src.String(), rel)).Repo().UnixStyle().Sting()
+		if r.Excludes.Match(RepoPath(name), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if r.tooLarge(info) {
+			return nil
+		}
+		c, err := r.liveContent(p, name)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			ret[name] = c
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// driftContents returns the files below src in HEAD and at the source.
+// Excluded files are left out on both sides.
+func (r GitRepo) driftContents(src SrcPath) (committed, live map[string]*DiffContent, err error) {
+	gitpath := src.Repo().UnixStyle()
+	repo, err := r.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	committed = map[string]*DiffContent{}
+	if _, err := repo.Head(); err == nil {
+		if committed, err = r.commitTreeContents("HEAD", gitpath); err != nil {
+			return nil, nil, err
+		}
+	}
+	for name := range committed {
+		if r.Excludes.Match(RepoPath(name), false) {
+			delete(committed, name)
+		}
+	}
+	live, err = r.srcTreeContents(src)
+	return committed, live, err
+}
+
+// GitSrcModified reports whether the live file or directory at src differs
+// from the latest committed version of its RepoPath
+func (r GitRepo) GitSrcModified(src SrcPath) (bool, error) {
+	committed, live, err := r.driftContents(src)
+	if err != nil {
+		return false, fmt.Errorf("git modified %v", err)
+	}
+	if len(committed) != len(live) {
+		return true, nil
+	}
+	for name, c := range committed {
+		l, ok := live[name]
+		if !ok || l.Hash() != c.Hash() || l.Mode != c.Mode {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GitDriftSrc compares the live file or directory at src with the latest
+// committed version of its RepoPath, without copying anything into the repo.
+// Returns an empty string if the source has not drifted since the last backup.
+func (r GitRepo) GitDriftSrc(src SrcPath, contextLines int) (string, error) {
+	committed, live, err := r.driftContents(src)
+	if err != nil {
+		return "", fmt.Errorf("git drift %v", err)
+	}
+	if len(committed) == 0 && len(live) == 0 {
+		return "", fmt.Errorf("git drift: %s not found in repo or at source", src)
+	}
+	names := []string{}
+	for k := range committed {
+		names = append(names, k)
+	}
+	for k := range live {
+		if _, ok := committed[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	pairs := [][2]*DiffContent{}
+	for _, name := range names {
+		pairs = append(pairs, [2]*DiffContent{committed[name], live[name]})
+	}
+	return UnifiedDiffs(pairs, contextLines)
+}
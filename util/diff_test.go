@@ -0,0 +1,177 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := &DiffContent{Path: "a.txt", Data: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n")}
+	to := &DiffContent{Path: "a.txt", Data: []byte("1\n2\n3\n4\nfive\n6\n7\n8\n9\n")}
+
+	diff, err := UnifiedDiff(from, to, 1)
+	if err != nil {
+		t.Fatalf("UnifiedDiff failed: %v", err)
+	}
+	for _, want := range []string{"--- a/a.txt", "+++ b/a.txt", "@@ -4,3 +4,3 @@", "-5\n", "+five\n", " 4\n", " 6\n"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Expected diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+	if strings.Contains(diff, "\n 3\n") {
+		t.Errorf("Expected only 1 context line, got:\n%s", diff)
+	}
+
+	diff, err = UnifiedDiff(from, to, DefaultDiffContext)
+	if err != nil {
+		t.Fatalf("UnifiedDiff failed: %v", err)
+	}
+	if !strings.Contains(diff, "@@ -2,7 +2,7 @@") {
+		t.Errorf("Expected 3 context lines, got:\n%s", diff)
+	}
+
+	if diff, err := UnifiedDiff(from, from, DefaultDiffContext); err != nil || diff != "" {
+		t.Errorf("Expected empty diff for equal content, got %q %v", diff, err)
+	}
+
+	diff, err = UnifiedDiff(nil, to, DefaultDiffContext)
+	if err != nil {
+		t.Fatalf("UnifiedDiff failed: %v", err)
+	}
+	if !strings.Contains(diff, "--- /dev/null") || !strings.Contains(diff, "+five\n") {
+		t.Errorf("Expected new file diff, got:\n%s", diff)
+	}
+}
+
+func TestGitDiffCommits(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	add_file(t, repoDir, "test.txt", "line1\nline2\n", r)
+	add_file(t, repoDir, "test.txt", "line1\nline two\n", r)
+
+	changes, err := r.GitLogFile("test.txt")
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("GitLogFile failed: %v %v", err, changes)
+	}
+	diff, err := r.GitDiffCommits("test.txt", changes[1].Commit, changes[0].Commit, DefaultDiffContext)
+	if err != nil {
+		t.Fatalf("GitDiffCommits failed: %v", err)
+	}
+	if !strings.Contains(diff, "-line2\n") || !strings.Contains(diff, "+line two\n") {
+		t.Errorf("Expected line level diff, got:\n%s", diff)
+	}
+
+	if _, err := r.GitDiffCommits("nonexistent.txt", changes[1].Commit, changes[0].Commit, DefaultDiffContext); err == nil {
+		t.Error("Expected error for file not in either commit")
+	}
+}
+
+func TestGitDiffSrc(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir, err := os.MkdirTemp("", "test-src-*")
+	if err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	src := filepath.Join(srcDir, "config.ini")
+	if err := os.WriteFile(src, []byte("a=1\nb=2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write src file: %v", err)
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(src))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+
+	if diff, err := r.GitDiffSrc(SrcPath(src), "", DefaultDiffContext); err != nil || diff != "" {
+		t.Fatalf("Expected no diff, got %q %v", diff, err)
+	}
+	if err := os.WriteFile(src, []byte("a=1\nb=3\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify src file: %v", err)
+	}
+	for _, commit := range []string{"", "HEAD"} {
+		diff, err := r.GitDiffSrc(SrcPath(src), commit, DefaultDiffContext)
+		if err != nil {
+			t.Fatalf("GitDiffSrc failed: %v", err)
+		}
+		if !strings.Contains(diff, "-b=2\n") || !strings.Contains(diff, "+b=3\n") {
+			t.Errorf("Expected line level diff against %q, got:\n%s", commit, diff)
+		}
+	}
+}
+
+func TestGitDriftSrc(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir, err := os.MkdirTemp("", "test-src-*")
+	if err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	keep := filepath.Join(srcDir, "keep.txt")
+	gone := filepath.Join(srcDir, "gone.txt")
+	for _, f := range []string{keep, gone} {
+		if err := os.WriteFile(f, []byte("v1\n"), 0644); err != nil {
+			t.Fatalf("Failed to write src file: %v", err)
+		}
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	if diff, err := r.GitDriftSrc(SrcPath(srcDir), DefaultDiffContext); err != nil || diff != "" {
+		t.Fatalf("Expected no drift, got %q %v", diff, err)
+	}
+
+	// Drift at the source must be reported without touching the repo copy
+	if err := os.WriteFile(keep, []byte("v2\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify src file: %v", err)
+	}
+	if err := os.Remove(gone); err != nil {
+		t.Fatalf("Failed to remove src file: %v", err)
+	}
+	added := filepath.Join(srcDir, "new.txt")
+	if err := os.WriteFile(added, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("Failed to write src file: %v", err)
+	}
+	diff, err := r.GitDriftSrc(SrcPath(srcDir), DefaultDiffContext)
+	if err != nil {
+		t.Fatalf("GitDriftSrc failed: %v", err)
+	}
+	for _, want := range []string{"-v1\n+v2\n", "deleted file mode", "new file mode", "+new\n"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Expected drift to contain %q, got:\n%s", want, diff)
+		}
+	}
+	if diff, err := r.GitDriftSrc(SrcPath(keep), DefaultDiffContext); err != nil || !strings.Contains(diff, "+v2\n") {
+		t.Errorf("Expected file drift, got %q %v", diff, err)
+	}
+	if _, err := os.Stat(SrcPath(gone).Repo().ToAbs(*r)); err != nil {
+		t.Errorf("Expected repo copy to be untouched: %v", err)
+	}
+}
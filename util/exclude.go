@@ -0,0 +1,85 @@
+package util
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// Excludes holds gitignore-style rules for paths in the repository
+type Excludes struct {
+	patterns []gitignore.Pattern
+}
+
+// Add adds rules that apply below dir; an empty dir applies them to the
+// whole repository. Blank lines and comments are ignored as in .gitignore.
+func (e *Excludes) Add(dir RepoPath, rules ...string) {
+	var domain []string
+	if d := dir.UnixStyle().Sting(); d != "" {
+		domain = strings.Split(d, "/")
+	}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		e.patterns = append(e.patterns, gitignore.ParsePattern(rule, domain))
+	}
+}
+
+// Empty reports whether there are no rules
+func (e Excludes) Empty() bool {
+	return len(e.patterns) == 0
+}
+
+// Match reports whether the repository path p is excluded
+func (e Excludes) Match(p RepoPath, isDir bool) bool {
+	if e.Empty() {
+		return false
+	}
+	name := p.UnixStyle().Sting()
+	if name == "" {
+		return false
+	}
+	return gitignore.NewMatcher(e.patterns).Match(strings.Split(name, "/"), isDir)
+}
+
+// GitExcluded lists files below gitpath in HEAD that match the exclude rules,
+// i.e. files that were backed up before the rules were added.
+func (r GitRepo) GitExcluded(gitpath RepoPath) ([]RepoPath, error) {
+	ret := []RepoPath{}
+	if r.Excludes.Empty() {
+		return ret, nil
+	}
+	repo, err := r.Open()
+	if err != nil {
+		return ret, err
+	}
+	if _, err := repo.Head(); err != nil {
+		// nothing committed yet
+		return ret, nil
+	}
+	err = r.walkCommitTree("", gitpath, func(name RepoPath, f *object.File) error {
+		if r.Excludes.Match(name, false) {
+			ret = append(ret, name)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrPathNotFound) {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// excludedPath reports whether the file system path dst below the repository
+// root is excluded
+func (r GitRepo) excludedPath(dst string, isDir bool) bool {
+	rel, err := r.Rel(dst)
+	if err != nil {
+		return false
+	}
+	return r.Excludes.Match(RepoPath(path.Clean(rel)), isDir)
+}
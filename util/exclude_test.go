@@ -0,0 +1,102 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExcludesMatch(t *testing.T) {
+	var e Excludes
+	e.Add("", "*.o", "# comment", "")
+	e.Add("home/me/proj", "node_modules/", "/build")
+	tests := []struct {
+		path  RepoPath
+		isDir bool
+		want  bool
+	}{
+		{"a/b/main.o", false, true},
+		{"a/b/main.c", false, false},
+		{"home/me/proj/node_modules", true, true},
+		{"home/me/proj/web/node_modules/x/index.js", false, true},
+		{"home/me/other/node_modules/x.js", false, false},
+		{"home/me/proj/build", true, true},
+		{"home/me/proj/src/build", true, false},
+	}
+	for _, tt := range tests {
+		if got := e.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%v) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCopyToRepoExclude(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir := t.TempDir()
+	for _, name := range []string{"main.c", "main.o", "node_modules/x/index.js"} {
+		p := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+
+	r.Excludes.Add("", "*.o")
+	r.Excludes.Add(gitpath, "node_modules/")
+	excluded, err := r.GitExcluded(gitpath)
+	if err != nil {
+		t.Fatalf("GitExcluded failed: %v", err)
+	}
+	if len(excluded) != 2 {
+		t.Errorf("Expected 2 excluded files already backed up, got %v", excluded)
+	}
+	// a path not backed up yet has nothing excluded
+	if excluded, err := r.GitExcluded(gitpath + "/missing"); err != nil || len(excluded) != 0 {
+		t.Errorf("Expected nothing for a missing path, got %v %v", excluded, err)
+	}
+
+	// new excluded files are neither copied nor staged
+	if err := os.WriteFile(filepath.Join(srcDir, "util.o"), []byte("o"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "node_modules", "y.js"), []byte("y"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "util.c"), []byte("c"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := r.CopyToRepo(SrcPath(srcDir)); err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := os.Stat(RepoRoot(r.root).With(gitpath.Sting() + "/util.o")); !os.IsNotExist(err) {
+		t.Errorf("Expected util.o not to be copied, got %v", err)
+	}
+	// staging skips excluded files even if they reach the worktree
+	if err := os.WriteFile(RepoRoot(r.root).With(gitpath.Sting()+"/util.o"), []byte("o"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	ret, err := r.GitAddFile(gitpath)
+	if err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	want := []RepoPath{RepoPath(gitpath.UnixStyle().Sting() + "/util.c")}
+	if !slices.Equal(ret.Files, want) {
+		t.Errorf("Expected only %v to be committed, got %v", want, ret.Files)
+	}
+}
@@ -1,17 +1,21 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	// "runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v6"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 )
 
@@ -19,9 +23,14 @@ type (
 	SysPath  string
 	RepoRoot string
 	GitRepo  struct {
-		Fs   afero.Fs // Added Fs field to support file system operations
-		root string
-		repo *git.Repository
+		Fs       afero.Fs      // Added Fs field to support file system operations
+		Excludes Excludes      // rules skipped when copying and staging
+		Symlinks SymlinkPolicy // how symlinks are copied into the repo
+		Author   Author        // author of backup commits
+		MaxSize  ByteSize      // larger files are skipped in directory backups
+		Remotes  map[string]Remote
+		root     string
+		repo     *git.Repository
 	}
 )
 
@@ -36,22 +45,7 @@ func (r GitRepo) Status(gitfile RepoPath) (GitStatusResult, error) {
 		} else if status, err := w.Status(); err != nil {
 			return ret, fmt.Errorf("status file status %v", err)
 		} else {
-			st := status.File(gitfile.Sting())
-			ret.Staging = GetStatuscode(st.Staging)
-			ret.Worktree = GetStatuscode(st.Worktree)
-			// ret.Status = make(GitStatus2)
-			ret.Status = status
-			// for k, v := range status {
-			// 	// if runtime.GOOS == "windows" {
-			// 	// 	k = strings.Replace(k, "/", "\\", -1)
-			// 	// }
-			// 	ret.Status[k] = &FileStatus2{
-			// 		Staging:  v.Staging,
-			// 		Worktree: v.Worktree,
-			// 		Extra:    v.Extra,
-			// 	}
-			// }
-			return ret, nil
+			return r.statusOf(status, gitfile), nil
 		}
 	}
 }
@@ -74,24 +68,32 @@ func (r GitRepo) Rel(s string) (string, error) {
 
 func (conf *GitRepo) CopyToRepo(src SrcPath) (RepoPath, error) {
 	// Verify source exists and get its info
-	srcInfo, err := os.Stat(src.String())
+	srcInfo, err := os.Lstat(src.String())
 	if err != nil {
 		return "", fmt.Errorf("copytorepo error stat src: %v", err)
 	}
+	if srcInfo.Mode()&os.ModeSymlink != 0 && conf.Symlinks == SymlinkSkip {
+		return "", fmt.Errorf("copytorepo %v is a symlink, skipped by policy", src)
+	}
+	if srcInfo.Mode()&os.ModeSymlink != 0 && conf.Symlinks != SymlinkPreserve {
+		if srcInfo, err = os.Stat(src.String()); err != nil {
+			return "", fmt.Errorf("copytorepo error stat src: %v", err)
+		}
+	}
+	if t := srcInfo.Mode().Type(); t&^(os.ModeDir|os.ModeSymlink) != 0 {
+		return "", fmt.Errorf("copytorepo %v is not a regular file (%v)", src, t)
+	}
+	if conf.tooLarge(srcInfo) {
+		return "", fmt.Errorf("copytorepo %v is larger than max_size %v", src, conf.MaxSize)
+	}
 
 	// Create destination path by appending src path (without leading /) to repo dir
 	ret := src.Repo()
 
 	reporoot := RepoRoot(conf.root)
 	dest := reporoot.With(ret.Sting())
-	// Copy based on whether src is a file or directory
-	if srcInfo.IsDir() {
-		err = copyDir(src.String(), dest)
-	} else {
-		err = copyFile(src.String(), dest)
-	}
-
-	if err != nil {
+	c := copier{symlinks: conf.Symlinks, skip: conf.excludedPath, maxSize: conf.MaxSize}
+	if err = c.copy(src.String(), dest); err != nil {
 		return "", fmt.Errorf("copytorepo error copying: %v", err)
 	}
 	return ret, nil
@@ -114,9 +116,25 @@ func (r *GitRepo) load(c *Config) error {
 		return fmt.Errorf("git repo %v is not a directory", conf.RepoDir)
 	}
 	r.root = conf.RepoDir.String()
+	r.Excludes.Add("", conf.Exclude...)
+	if r.Symlinks, err = ParseSymlinkPolicy(conf.Symlinks); err != nil {
+		return fmt.Errorf("git repo %v", err)
+	}
+	r.Author = conf.Author
+	r.MaxSize = conf.MaxSize
+	r.Remotes = conf.Remotes
 	return nil
 }
 
+// signature returns the author of a commit made now
+func (r GitRepo) signature() *object.Signature {
+	name := r.Author.Name
+	if name == "" {
+		name = "anybakup"
+	}
+	return &object.Signature{Name: name, Email: r.Author.Email, When: time.Now()}
+}
+
 func (r GitRepo) AbsRepo2Repo(s string) RepoPath {
 	rel, err := filepath.Rel(r.root, s)
 	if err != nil {
@@ -214,7 +232,7 @@ func (r GitRepo) CleanEmptyDir(path string) ([]RepoPath, error) {
 			if strings.Contains(newVar, ".git") {
 				continue
 			}
-			fmt.Println(">>rmdir empty dir", newVar)
+			logrus.Debugf("rmdir empty dir %v", newVar)
 			os.RemoveAll(newVar)
 			if s := r.AbsRepo2Repo(newVar); s != "" {
 				n = append(n, s)
@@ -262,7 +280,7 @@ func (r GitRepo) GitRmFile(realpath RepoPath) (GitResult, error) {
 		if err != nil {
 			return ret, fmt.Errorf("git rm err=%v file=%v:%v", err, realpath, f)
 		} else {
-			fmt.Println(">>>>>>rm", f.Sting())
+			logrus.Debugf("git rm %v", f)
 		}
 	}
 	afterState, err := r.Status(realpath)
@@ -277,12 +295,15 @@ func (r GitRepo) GitRmFile(realpath RepoPath) (GitResult, error) {
 		ret.Action = GitResultTypeNochange
 		return ret, nil
 	} else {
+		if err := r.unstageMeta(w, files); err != nil {
+			return ret, fmt.Errorf("git rm metadata %v", err)
+		}
+		if _, err := r.stageTags(w, func(t Tags) { t.drop(realpath) }); err != nil {
+			return ret, fmt.Errorf("git rm tags %v", err)
+		}
 		msg := fmt.Sprintf("RM %v", realpath)
 		_, err = w.Commit(msg, &git.CommitOptions{
-			Author: &object.Signature{
-				Name: "anybakup",
-				When: time.Now(),
-			},
+			Author: r.signature(),
 		})
 		if err != nil {
 			return ret, fmt.Errorf("git commit err=%v file=%v:%v", err, realpath, realpath)
@@ -290,14 +311,16 @@ func (r GitRepo) GitRmFile(realpath RepoPath) (GitResult, error) {
 		ret.Action = GitResultTypeRm
 		files, _ = r.CleanEmptyDir(r.root)
 		ret.Dirs = files
+		r.autoPush()
 		return ret, nil
 	}
 }
 
 type GitResult struct {
-	Action GitAction
-	Files  []RepoPath
-	Dirs   []RepoPath
+	Action  GitAction  `json:"action"`
+	Files   []RepoPath `json:"files"`
+	Dirs    []RepoPath `json:"dirs,omitempty"`
+	Deleted []RepoPath `json:"deleted,omitempty"` // files removed by GitAddFiles, see MirrorDeletes
 }
 type GitAction string
 
@@ -309,78 +332,199 @@ const (
 )
 
 func (r GitRepo) GitAddFile(gitpath RepoPath, tag ...string) (GitResult, error) {
-	gitpath = gitpath.UnixStyle()
-	abspath := gitpath.ToAbs(r)
-	// gitfile := gitpath.Sting()
+	return r.GitAddFiles([]RepoPath{gitpath}, false, tag...)
+}
+
+// statusOf returns the worktree status filtered to gitpath
+func (r GitRepo) statusOf(status git.Status, gitpath RepoPath) GitStatusResult {
+	st := status.File(gitpath.Sting())
+	return GitStatusResult{
+		Staging:  GetStatuscode(st.Staging),
+		Worktree: GetStatuscode(st.Worktree),
+		Status:   status,
+		Path:     gitpath,
+	}
+}
+
+// GitAddFiles stages every path in gitpaths and commits them as a single
+// snapshot. The worktree status is computed once for all paths. With mirror,
+// copies deleted below gitpaths by MirrorDeletes are committed as deletions;
+// otherwise deletions in the worktree are left alone.
+func (r GitRepo) GitAddFiles(gitpaths []RepoPath, mirror bool, tag ...string) (GitResult, error) {
 	ret := GitResult{
 		Action: GitResultTypeError,
 	}
+	if len(gitpaths) == 0 {
+		ret.Action = GitResultTypeNochange
+		return ret, nil
+	}
+	// normalise a copy, the slice belongs to the caller
+	gitpaths = slices.Clone(gitpaths)
+	for i := range gitpaths {
+		gitpaths[i] = gitpaths[i].UnixStyle()
+	}
 	repo, err := r.Open()
 	if err != nil {
 		return ret, fmt.Errorf("git add %v", err)
 	}
 	w, err := repo.Worktree()
 	if err != nil {
-		return ret, fmt.Errorf("git add %v %v", err, abspath)
+		return ret, fmt.Errorf("git add %v %v", err, r.root)
 	}
-	fmt.Println("-----------------Before---------------")
-	state, err := r.Status(gitpath)
+	w.Excludes = r.Excludes.patterns
+	status, err := w.Status()
 	if err != nil {
 		return ret, fmt.Errorf("git add %v", err)
 	}
-	state.print("before add")
-	needtoAddFiles := state.NeedGitAddFiles()
+	needtoAddFiles := []RepoPath{}
+	needtoRmFiles := []RepoPath{}
+	staged := map[string]bool{}
+	for k, v := range status {
+		if v.Staging == git.Deleted {
+			staged[k] = true
+		}
+	}
+	for _, gitpath := range gitpaths {
+		state := r.statusOf(status, gitpath)
+		state.print("before add")
+		for _, v := range state.NeedGitAddFiles() {
+			if !slices.Contains(needtoAddFiles, v) {
+				needtoAddFiles = append(needtoAddFiles, v)
+			}
+		}
+		if !mirror {
+			continue
+		}
+		// copies removed from the worktree, see MirrorDeletes
+		for _, v := range state.NeedGitRMFiles(true) {
+			if !slices.Contains(needtoRmFiles, v) {
+				needtoRmFiles = append(needtoRmFiles, v)
+			}
+		}
+	}
 	for _, v := range needtoAddFiles {
-		fmt.Printf(">>>>>find need to change %v\n", v)
+		logrus.Debugf("need to add %v", v)
+	}
+	// metadata changes leave the content alone, see staleMeta
+	metaFiles, err := r.staleMeta(repo, gitpaths)
+	if err != nil {
+		return ret, fmt.Errorf("git add metadata %v", err)
 	}
-	if len(needtoAddFiles) == 0 {
+	if len(needtoAddFiles) == 0 && len(needtoRmFiles) == 0 && len(metaFiles) == 0 {
 		ret.Action = GitResultTypeNochange
 		return ret, nil
 	}
 	for _, gitfile := range needtoAddFiles {
 		_, err = w.Add(gitfile.Sting())
 		if err != nil {
-			fmt.Printf(">>>>>%v git add %v %v\n", r.root, gitfile, err)
 			return ret, fmt.Errorf("git add %v %v", err, gitfile)
 		} else {
-			fmt.Printf(">>>>>%v git add %v %v\n", r.root, gitfile, "ok")
+			logrus.Debugf("%v git add %v", r.root, gitfile)
 		}
 	}
+	for _, gitfile := range needtoRmFiles {
+		// adding the parent directory may have staged the deletion already
+		if _, err = w.Remove(gitfile.Sting()); err != nil && !errors.Is(err, index.ErrEntryNotFound) {
+			return ret, fmt.Errorf("git rm %v %v", err, gitfile)
+		}
+		logrus.Debugf("git rm %v", gitfile)
+	}
 
-	fmt.Println("-----------------after----------------")
-
-	state, err = r.Status(gitpath)
+	status, err = w.Status()
 	if err != nil {
 		return ret, fmt.Errorf("git add %v", err)
 	}
+	if !mirror {
+		// adding a directory stages the deletions below it, undo that
+		files := []string{}
+		for k, v := range status {
+			if v.Staging == git.Deleted && !staged[k] {
+				files = append(files, k)
+			}
+		}
+		if len(files) > 0 {
+			if err := w.Restore(&git.RestoreOptions{Staged: true, Files: files}); err != nil {
+				return ret, fmt.Errorf("git add %v", err)
+			}
+			if status, err = w.Status(); err != nil {
+				return ret, fmt.Errorf("git add %v", err)
+			}
+		}
+	}
+	state := r.statusOf(status, gitpaths[0])
 	state.print("after add")
 	action := state.NeedGitCommit()
-	fmt.Printf("action %s\n", action)
+	if action == "" && len(metaFiles) > 0 {
+		action = "UPDATE"
+	}
+	logrus.Debugf("action %s", action)
 	if action == "" {
 		ret.Action = GitResultTypeNochange
 		return ret, nil
 	}
+	if action == "RM" {
+		// only mirrored deletions, the path itself is still tracked
+		action = "UPDATE"
+	}
 	// Handle optional tag parameter
 	var tagStr string
 	if len(tag) > 0 && tag[0] != "" {
 		tagStr = fmt.Sprintf(" [%s]", tag[0])
 	}
-	msg := fmt.Sprintf("%v %v%v", action, gitpath, tagStr)
+	msg := fmt.Sprintf("%v %v%v", action, gitpaths[0], tagStr)
+	if len(gitpaths) > 1 {
+		msg = fmt.Sprintf("%v %d paths%v\n", action, len(gitpaths), tagStr)
+		for _, gitpath := range gitpaths {
+			msg += fmt.Sprintf("\n%v", gitpath)
+		}
+	}
 	options := []git.StatusCode{git.Added, git.Modified}
 	ret.Files = state.NeedGitCommitFiles(options)
 	for _, k := range ret.Files {
-		fmt.Printf(">>>>need to commit %v\n", k)
+		logrus.Debugf("need to commit %v", k)
+	}
+	ret.Deleted = state.NeedGitCommitFiles([]git.StatusCode{git.Deleted})
+	slices.Sort(ret.Deleted)
+	for i, k := range ret.Deleted {
+		if i == 0 {
+			msg += "\n"
+		}
+		msg += fmt.Sprintf("\nRM %v", k)
+	}
+	if err := r.stageMeta(w, slices.Concat(ret.Files, ret.Deleted, metaFiles)); err != nil {
+		return ret, fmt.Errorf("git add metadata %v", err)
+	}
+	if tagStr != "" {
+		// paths already carrying the tag keep the tags below them
+		retag := func(t Tags) {
+			for _, p := range gitpaths {
+				if t.Of(p) != tag[0] {
+					t.set(tag[0], p)
+				}
+			}
+		}
+		if _, err := r.stageTags(w, retag); err != nil {
+			return ret, fmt.Errorf("git add tags %v", err)
+		}
 	}
 	_, err = w.Commit(msg, &git.CommitOptions{
-		Author: &object.Signature{
-			Name: "anybakup",
-			When: time.Now(),
-		},
+		Author: r.signature(),
 	})
 	if err != nil {
-		return ret, fmt.Errorf("git commit %v %v", err, abspath)
+		// keep the deletions out of the next commit
+		if len(needtoRmFiles) > 0 {
+			files := []string{}
+			for _, f := range needtoRmFiles {
+				files = append(files, f.Sting())
+			}
+			if err := w.Restore(&git.RestoreOptions{Staged: true, Files: files}); err != nil {
+				logrus.Warnf("unstage deletions: %v", err)
+			}
+		}
+		return ret, fmt.Errorf("git commit %v %v", err, gitpaths)
 	}
 	ret.Action = GitResultTypeAdd
+	r.autoPush()
 	return ret, nil
 }
 
@@ -435,8 +579,9 @@ func (r GitRepo) GitViewFile(gitpath RepoPath, commitHash string, outpath string
 }
 
 // GitDiffFile compares a file between working directory and HEAD commit
-// Returns the diff as a string, or empty string if no changes
-func (r GitRepo) GitDiffFile(file string) (string, error) {
+// Returns the unified diff as a string, or empty string if no changes.
+// contextLines defaults to DefaultDiffContext.
+func (r GitRepo) GitDiffFile(file string, contextLines ...int) (string, error) {
 	repo, err := r.Open()
 	if err != nil {
 		return "", fmt.Errorf("git diff %v", err)
@@ -446,92 +591,70 @@ func (r GitRepo) GitDiffFile(file string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("git diff %v %v", err, file)
 	}
+	gitpath := RepoPath(gitfile).UnixStyle()
 
-	// Get HEAD commit
-	ref, err := repo.Head()
-	if err != nil {
-		return "", fmt.Errorf("git diff: failed to get HEAD: %v", err)
-	}
-
-	commit, err := repo.CommitObject(ref.Hash())
-	if err != nil {
-		return "", fmt.Errorf("git diff: failed to get commit: %v", err)
-	}
-
-	// Get the tree from HEAD commit
-	headTree, err := commit.Tree()
-	if err != nil {
-		return "", fmt.Errorf("git diff: failed to get tree: %v", err)
-	}
-
-	// Get worktree
-	w, err := repo.Worktree()
-	if err != nil {
-		return "", fmt.Errorf("git diff: failed to get worktree: %v", err)
-	}
-
-	// Get current worktree status
-	status, err := w.Status()
-	if err != nil {
-		return "", fmt.Errorf("git diff: failed to get status: %v", err)
+	ctx := DefaultDiffContext
+	if len(contextLines) > 0 {
+		ctx = contextLines[0]
 	}
 
-	// Check if file has changes
-	fileStatus := status.File(gitfile)
-	if fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified {
-		return "", nil // No changes
-	}
-
-	// Get file content from HEAD
-	headFile, err := headTree.File(gitfile)
-	var headContent string
-	if err == nil {
-		headContent, err = headFile.Contents()
-		if err != nil {
+	// File doesn't exist in HEAD (new file or empty repo)
+	var head *DiffContent
+	if _, err := repo.Head(); err == nil {
+		if head, err = r.commitFileContent("HEAD", gitpath); err != nil {
 			return "", fmt.Errorf("git diff: failed to read HEAD content: %v", err)
 		}
-	} else {
-		// File doesn't exist in HEAD (new file)
-		headContent = ""
 	}
 
 	// Get file content from working directory
-	absPath := filepath.Join(r.root, gitfile)
-	workingContent, err := os.ReadFile(absPath)
+	working, err := NewDiffContentFromFile(gitpath.ToAbs(r), gitpath.Sting())
 	if err != nil {
 		return "", fmt.Errorf("git diff: failed to read working file: %v", err)
 	}
-
-	// Simple diff representation
-	diff := ""
-	if headContent != string(workingContent) {
-		diff += fmt.Sprintf("--- a/%s\n+++ b/%s\n", gitfile, gitfile)
-		diff += "@@ File changed @@\n"
-		diff += fmt.Sprintf("- HEAD: %d bytes\n", len(headContent))
-		diff += fmt.Sprintf("+ Working: %d bytes\n", len(workingContent))
+	if head == nil && working == nil {
+		return "", fmt.Errorf("git diff: %v not found", gitpath)
 	}
-
-	return diff, nil
+	return UnifiedDiff(head, working, ctx)
 }
 
 type GitChanges struct {
-	Commit  string
-	Author  string
-	Date    string
-	Message string
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Message string `json:"message"`
 }
 
 // GitLogFile retrieves the commit history for a specific file
 // Returns a formatted string with commit logs
 func (r GitRepo) GitLogFile(repoRelPath RepoPath) ([]GitChanges, error) {
 	repoRelPath = repoRelPath.UnixStyle()
-	repo := r.repo
 	gitfile := repoRelPath.Sting()
 
 	// Get commit log with file path filter
-	commitIter, err := repo.Log(&git.LogOptions{
+	return r.gitLog(gitfile, &git.LogOptions{
 		FileName: &gitfile,
 	})
+}
+
+// pathFilter matches gitfile itself and, for a directory, every path below it
+func pathFilter(gitfile string) func(string) bool {
+	return func(p string) bool {
+		return p == gitfile || strings.HasPrefix(p, gitfile+"/")
+	}
+}
+
+// GitLogPath retrieves the commit history for a file or a directory;
+// for a directory every commit touching a file below it is listed
+func (r GitRepo) GitLogPath(repoRelPath RepoPath) ([]GitChanges, error) {
+	gitfile := repoRelPath.UnixStyle().Sting()
+	return r.gitLog(gitfile, &git.LogOptions{
+		PathFilter: pathFilter(gitfile),
+	})
+}
+
+func (r GitRepo) gitLog(gitfile string, options *git.LogOptions) ([]GitChanges, error) {
+	repo := r.repo
+	commitIter, err := repo.Log(options)
 	if err != nil {
 		return nil, fmt.Errorf("git changes: failed to get log: %v", err)
 	}
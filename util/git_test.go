@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -37,12 +38,12 @@ func setupGitTestEnv(t *testing.T) (repoDir string, config *Config, cleanup func
 		t.Fatalf("Failed to write config file: %v", err)
 	}
 
-	// Set HOME to temp directory so config is loaded from there
-	oldHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
+	// Point the config lookup at the temp config file
+	oldConfig := os.Getenv("ANYBAKUP_CONFIG")
+	os.Setenv("ANYBAKUP_CONFIG", configFile)
 
 	cleanup = func() {
-		os.Setenv("HOME", oldHome)
+		os.Setenv("ANYBAKUP_CONFIG", oldConfig)
 		os.RemoveAll(tmpDir)
 	}
 
@@ -725,6 +726,26 @@ func TestGitStatusFile(t *testing.T) {
 	}
 }
 
+// TestGitStatusResultBoundary tests that paths match on a / boundary
+func TestGitStatusResultBoundary(t *testing.T) {
+	s := GitStatusResult{
+		Path: "home/foo",
+		Status: git.Status{
+			"home/foo":        &git.FileStatus{Worktree: git.Deleted},
+			"home/foo/a.txt":  &git.FileStatus{Worktree: git.Deleted},
+			"home/foobar/b":   &git.FileStatus{Worktree: git.Deleted},
+			"home/foo/new.go": &git.FileStatus{Worktree: git.Untracked},
+			"home/foobar/new": &git.FileStatus{Worktree: git.Untracked},
+		},
+	}
+	if got := s.NeedGitRMFiles(true); len(got) != 2 || slices.Contains(got, "home/foobar/b") {
+		t.Errorf("Expected only paths below home/foo, got %v", got)
+	}
+	if got := s.NeedGitAddFiles(); len(got) != 1 || got[0] != "home/foo/new.go" {
+		t.Errorf("Expected only home/foo/new.go, got %v", got)
+	}
+}
+
 // TestGitViewFile tests checking out a file from a specific commit
 func TestGitViewFile(t *testing.T) {
 	repoDir, c, cleanup := setupGitTestEnv(t)
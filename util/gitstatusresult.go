@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/go-git/go-git/v6"
+	"github.com/sirupsen/logrus"
 )
 
 type FileStatus2 struct {
@@ -37,8 +38,8 @@ type GitStatusResult struct {
 
 func (s GitStatusResult) print(preifx string) {
 	// fmt.Printf("%-10s status to string: %v", preifx, s.StatusOrgin.String())
-	fmt.Printf("%-10s %v", preifx, s.Status.String())
-	fmt.Printf("%-10s %-50s s:%v w:%v\n", preifx, s.Path, s.Staging, s.Worktree)
+	logrus.Debugf("%-10s %v", preifx, s.Status.String())
+	logrus.Debugf("%-10s %-50s s:%v w:%v", preifx, s.Path, s.Staging, s.Worktree)
 }
 
 func (s GitStatusResult) NeedGitCommitFiles(states []git.StatusCode) (ret []RepoPath) {
@@ -52,22 +53,27 @@ func (s GitStatusResult) NeedGitCommitFiles(states []git.StatusCode) (ret []Repo
 }
 
 func (s GitStatusResult) NeedGitCommit() string {
+	// ADD wins over UPDATE over RM, independent of the map order
 	action := ""
 	for _, v := range s.Status {
-		status := v.Staging
-		switch status {
+		switch v.Staging {
 		case git.Added:
-			action = "ADD"
-		case git.Deleted:
-			action = "RM"
+			return "ADD"
 		case git.Modified:
 			action = "UPDATE"
-		}
-		if action != "" {
-			return action
+		case git.Deleted:
+			if action == "" {
+				action = "RM"
+			}
 		}
 	}
-	return ""
+	return action
+}
+
+// covers reports whether the status path k is s.Path or lies below it
+func (s GitStatusResult) covers(k string) bool {
+	p := s.Path.UnixStyle().Sting()
+	return p == "" || k == p || strings.HasPrefix(k, p+"/")
 }
 
 func (s GitStatusResult) NeedGitRMFiles(work bool) (ret []RepoPath) {
@@ -77,7 +83,7 @@ func (s GitStatusResult) NeedGitRMFiles(work bool) (ret []RepoPath) {
 			status = v.Staging
 		}
 		if status == git.Deleted {
-			if strings.HasPrefix(k, s.Path.Sting()) {
+			if s.covers(k) {
 				ret = append(ret, RepoPath(k))
 			}
 		}
@@ -89,7 +95,7 @@ func (s GitStatusResult) NeedGitAddFiles() (ret []RepoPath) {
 	for k, v := range s.Status {
 		status := v.Worktree
 		if status == git.Modified || status == git.Untracked {
-			if strings.HasPrefix(k, s.Path.Sting()) {
+			if s.covers(k) {
 				ret = append(ret, RepoPath(k))
 			}
 		}
@@ -125,13 +131,12 @@ func CheckStatus(git *git.Repository) (git.Status, error) {
 
 	// w.StatusWithOptions(git.StatusOptions{Strategy: git.Preload})
 	status, err := w.Status()
-	fmt.Printf("status to string: %v", status.String())
-	fmt.Println("")
+	logrus.Debugf("status to string: %v", status.String())
 	if err != nil {
 		return nil, fmt.Errorf("workstate err=%v", err)
 	}
 	for a, k := range status {
-		fmt.Printf("%-50s Staging=%c worktree=%c Extra=%s\n", a, k.Staging, k.Worktree, k.Extra)
+		logrus.Debugf("%-50s Staging=%c worktree=%c Extra=%s", a, k.Staging, k.Worktree, k.Extra)
 	}
 	return status, nil
 }
@@ -0,0 +1,209 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// TrackedPath is a path added to the backup on its own, as recorded in the
+// commit messages written by GitAddFiles and GitRmFile
+type TrackedPath struct {
+	Path RepoPath
+	Tag  string
+}
+
+// manyPaths is the subject of a commit listing its paths in the body
+var manyPaths = regexp.MustCompile(`^\d+ paths$`)
+
+// parseCommitMessage splits a commit message into its action, tag, the paths
+// it adds or updates and the paths it removes
+func parseCommitMessage(msg string) (action, tag string, paths, removed []RepoPath) {
+	lines := strings.Split(strings.TrimRight(msg, "\n"), "\n")
+	action, subject, _ := strings.Cut(lines[0], " ")
+	if i := strings.LastIndex(subject, " ["); i >= 0 && strings.HasSuffix(subject, "]") {
+		tag = subject[i+2 : len(subject)-1]
+		subject = subject[:i]
+	}
+	many := manyPaths.MatchString(subject)
+	for _, line := range lines[1:] {
+		if p, ok := strings.CutPrefix(line, "RM "); ok {
+			removed = append(removed, RepoPath(p))
+		} else if many && line != "" {
+			paths = append(paths, RepoPath(line))
+		}
+	}
+	if !many && subject != "" {
+		if action == "RM" {
+			removed = append(removed, RepoPath(subject))
+		} else {
+			paths = append(paths, RepoPath(subject))
+		}
+	}
+	return action, tag, paths, removed
+}
+
+// headCommits returns the commits of HEAD, oldest first. A repository
+// without commits has none.
+func (r GitRepo) headCommits() ([]*object.Commit, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.Head(); err != nil {
+		return nil, nil
+	}
+	iter, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("git log: %v", err)
+	}
+	commits := []*object.Commit{}
+	if err := iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("git log: %v", err)
+	}
+	slices.Reverse(commits)
+	return commits, nil
+}
+
+// GitTrackedPaths replays the commit messages from the first commit to HEAD
+// and returns the paths added and not removed since, in the order they were
+// first added. An update without a tag keeps the tag given before.
+func (r GitRepo) GitTrackedPaths() ([]TrackedPath, error) {
+	commits, err := r.headCommits()
+	if err != nil {
+		return nil, err
+	}
+	ret := []TrackedPath{}
+	for _, c := range commits {
+		action, tag, paths, removed := parseCommitMessage(c.Message)
+		if action != "ADD" && action != "UPDATE" && action != "RM" {
+			continue
+		}
+		for _, p := range paths {
+			i := slices.IndexFunc(ret, func(t TrackedPath) bool { return t.Path == p })
+			if i < 0 {
+				ret = append(ret, TrackedPath{Path: p, Tag: tag})
+			} else if tag != "" {
+				ret[i].Tag = tag
+			}
+		}
+		ret = slices.DeleteFunc(ret, func(t TrackedPath) bool { return slices.Contains(removed, t.Path) })
+	}
+	return ret, nil
+}
+
+// PathHistory tells how often and when a path was changed
+type PathHistory struct {
+	Revs  int
+	First time.Time
+	Last  time.Time
+}
+
+// GitPathHistory walks the log of HEAD once and returns the history of every
+// path a commit changed, including paths deleted since. Commits are compared
+// with their first parent; the times are the author times. Deletions are not
+// revisions, and a path added again after a deletion starts a new history.
+func (r GitRepo) GitPathHistory() (map[RepoPath]PathHistory, error) {
+	commits, err := r.headCommits()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[RepoPath]PathHistory{}
+	deleted := map[string]bool{}
+	for _, c := range commits {
+		changes, err := commitChanges(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			name := change.To.Name
+			if name == "" {
+				deleted[change.From.Name] = true
+				continue
+			}
+			h := ret[RepoPath(name)]
+			if deleted[name] {
+				h = PathHistory{}
+				delete(deleted, name)
+			}
+			if h.Revs == 0 {
+				h.First = c.Author.When
+			}
+			h.Revs++
+			h.Last = c.Author.When
+			ret[RepoPath(name)] = h
+		}
+	}
+	return ret, nil
+}
+
+// commitChanges returns the changes of c against its first parent
+func commitChanges(c *object.Commit) (object.Changes, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("git history %v: %v", c.Hash, err)
+	}
+	var parent *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("git history %v: %v", c.Hash, err)
+		}
+		if parent, err = p.Tree(); err != nil {
+			return nil, fmt.Errorf("git history %v: %v", c.Hash, err)
+		}
+	}
+	changes, err := object.DiffTree(parent, tree)
+	if err != nil {
+		return nil, fmt.Errorf("git history %v: %v", c.Hash, err)
+	}
+	return changes, nil
+}
+
+// GitHeadFiles lists the files of the HEAD commit, without the metadata
+// manifest. A repository without commits has no files.
+func (r GitRepo) GitHeadFiles() ([]RepoPath, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, nil
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("git head files: %v", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("git head files: %v", err)
+	}
+	ret := []RepoPath{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !isMetaPath(RepoPath(f.Name)) {
+			ret = append(ret, RepoPath(f.Name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git head files: %v", err)
+	}
+	return ret, nil
+}
+
+// GitClone clones the backup repository at url into dir
+func GitClone(url, dir string) error {
+	if _, err := git.PlainClone(dir, &git.CloneOptions{URL: url}); err != nil {
+		return fmt.Errorf("git clone %v %v", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCommitMessage(t *testing.T) {
+	tests := []struct {
+		msg           string
+		action, tag   string
+		paths, remove []RepoPath
+	}{
+		{"ADD home/u/a.txt", "ADD", "", []RepoPath{"home/u/a.txt"}, nil},
+		{"UPDATE home/u/docs [work]", "UPDATE", "work", []RepoPath{"home/u/docs"}, nil},
+		{"RM home/u/a.txt", "RM", "", nil, []RepoPath{"home/u/a.txt"}},
+		{"ADD 2 paths [x]\n\nhome/a\nhome/b\n\nRM home/b/old", "ADD", "x", []RepoPath{"home/a", "home/b"}, []RepoPath{"home/b/old"}},
+		{"UPDATE home/d\n\nRM home/d/gone", "UPDATE", "", []RepoPath{"home/d"}, []RepoPath{"home/d/gone"}},
+	}
+	for _, tt := range tests {
+		action, tag, paths, removed := parseCommitMessage(tt.msg)
+		if action != tt.action || tag != tt.tag || !slices.Equal(paths, tt.paths) || !slices.Equal(removed, tt.remove) {
+			t.Errorf("%q: got %v %q %v %v", tt.msg, action, tag, paths, removed)
+		}
+	}
+}
+
+func TestGitTrackedPaths(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	r, gitpath := setupAddFile(t, repoDir, c)
+	if tracked, err := r.GitTrackedPaths(); err != nil || len(tracked) != 1 || tracked[0].Path != gitpath {
+		t.Fatalf("unexpected tracked paths %v %v", tracked, err)
+	}
+	add_file(t, repoDir, "other.txt", "other", r)
+	add_file(t, repoDir, "test.txt", "test v2", r)
+	if _, err := r.GitRmFile(gitpath); err != nil {
+		t.Fatal(err)
+	}
+	tracked, err := r.GitTrackedPaths()
+	if err != nil || len(tracked) != 1 || tracked[0].Path != "other.txt" {
+		t.Errorf("unexpected tracked paths %v %v", tracked, err)
+	}
+	files, err := r.GitHeadFiles()
+	if err != nil || !slices.Equal(files, []RepoPath{"other.txt"}) {
+		t.Errorf("unexpected head files %v %v", files, err)
+	}
+	history, err := r.GitPathHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := history[gitpath]; h.Revs != 2 || h.First.After(h.Last) {
+		t.Errorf("unexpected history of a removed file %+v", h)
+	}
+	if h := history["other.txt"]; h.Revs != 1 || !h.First.Equal(h.Last) {
+		t.Errorf("unexpected history %+v", h)
+	}
+	// a path added again after its removal starts over
+	add_file(t, repoDir, "test.txt", "test v3", r)
+	if history, err = r.GitPathHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if h := history[gitpath]; h.Revs != 1 {
+		t.Errorf("unexpected history of a re-added file %+v", h)
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogCallback receives every log entry when installed with SetLogCallback
+type LogCallback func(level logrus.Level, msg string)
+
+var logMu sync.Mutex
+
+// SetLogLevel sets the level of the logger; empty means info
+func SetLogLevel(level string) error {
+	if level == "" {
+		level = logrus.InfoLevel.String()
+	}
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(l)
+	return nil
+}
+
+// callbackHook forwards log entries to a LogCallback
+type callbackHook struct {
+	fn LogCallback
+}
+
+func (h callbackHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h callbackHook) Fire(e *logrus.Entry) error {
+	h.fn(e.Level, e.Message)
+	return nil
+}
+
+// SetLogCallback sends log entries to fn instead of stderr. A nil fn
+// restores logging to stderr.
+func SetLogCallback(fn LogCallback) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	hooks := logrus.LevelHooks{}
+	var out io.Writer = os.Stderr
+	if fn != nil {
+		hooks.Add(callbackHook{fn: fn})
+		out = io.Discard
+	}
+	logrus.StandardLogger().ReplaceHooks(hooks)
+	logrus.SetOutput(out)
+}
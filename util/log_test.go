@@ -0,0 +1,42 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	if err := SetLogLevel("debug"); err != nil || logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("expected debug level, got %v %v", logrus.GetLevel(), err)
+	}
+	if err := SetLogLevel(""); err != nil || logrus.GetLevel() != logrus.InfoLevel {
+		t.Errorf("expected info level, got %v %v", logrus.GetLevel(), err)
+	}
+	if err := SetLogLevel("loud"); err == nil {
+		t.Error("expected unknown level to fail")
+	}
+}
+
+func TestSetLogCallback(t *testing.T) {
+	defer SetLogCallback(nil)
+	type entry struct {
+		level logrus.Level
+		msg   string
+	}
+	got := []entry{}
+	SetLogCallback(func(level logrus.Level, msg string) {
+		got = append(got, entry{level, msg})
+	})
+	logrus.Warnf("skip %v", "fifo")
+	logrus.Debugf("hidden")
+	if len(got) != 1 || got[0] != (entry{logrus.WarnLevel, "skip fifo"}) {
+		t.Errorf("unexpected log entries %v", got)
+	}
+	SetLogCallback(nil)
+	logrus.Warnf("to stderr")
+	if len(got) != 1 {
+		t.Errorf("expected the callback to be removed, got %v", got)
+	}
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/sirupsen/logrus"
+)
+
+// metaDir is the repo directory holding the manifests, see isMetaPath
+const metaDir = ".anybakup/"
+
+// MetaManifest is the repo path of the sidecar manifest holding the file
+// metadata git does not keep. It is committed together with the files.
+const MetaManifest RepoPath = metaDir + "meta.json"
+
+// FileMeta is the POSIX metadata of a backed up file
+type FileMeta struct {
+	Mode   os.FileMode       `json:"mode"`
+	Uid    int               `json:"uid"`
+	Gid    int               `json:"gid"`
+	User   string            `json:"user,omitempty"`
+	Group  string            `json:"group,omitempty"`
+	Mtime  time.Time         `json:"mtime"`
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// Manifest maps unix style repo paths to their metadata
+type Manifest map[RepoPath]FileMeta
+
+// statMeta reads the metadata of path; symlinks are not followed
+func statMeta(path string) (FileMeta, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	meta := FileMeta{
+		Mode:  info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky | os.ModeSymlink),
+		Mtime: info.ModTime(),
+	}
+	meta.Uid, meta.Gid, meta.User, meta.Group = fileOwner(info)
+	if meta.Xattrs, err = getXattrs(path); err != nil {
+		logrus.Warnf("read xattrs of %v: %v", path, err)
+	}
+	return meta, nil
+}
+
+// equal reports whether m and o record the same owner, mode and xattrs. The
+// mtime is left out: a touch alone is not worth a backup.
+func (m FileMeta) equal(o FileMeta) bool {
+	return m.Mode == o.Mode && m.Uid == o.Uid && m.Gid == o.Gid &&
+		maps.EqualFunc(m.Xattrs, o.Xattrs, bytes.Equal)
+}
+
+// applyMeta sets ownership, special mode bits, xattrs and mtime of path.
+// Failures are reported as warnings since e.g. chown needs root.
+func applyMeta(path string, meta FileMeta) {
+	for name, value := range meta.Xattrs {
+		if err := setXattr(path, name, value); err != nil {
+			logrus.Warnf("restore xattr %v of %v: %v", name, path, err)
+		}
+	}
+	if err := chownFile(path, meta.Uid, meta.Gid); err != nil {
+		logrus.Warnf("restore owner %d:%d of %v: %v", meta.Uid, meta.Gid, path, err)
+	}
+	if meta.Mode&os.ModeSymlink != 0 {
+		return
+	}
+	// chown clears setuid and setgid, so the mode is applied afterwards
+	if err := os.Chmod(path, meta.Mode); err != nil {
+		logrus.Warnf("restore mode of %v: %v", path, err)
+	}
+	if err := os.Chtimes(path, meta.Mtime, meta.Mtime); err != nil {
+		logrus.Warnf("restore mtime of %v: %v", path, err)
+	}
+}
+
+func parseManifest(data []byte) (Manifest, error) {
+	m := Manifest{}
+	if len(data) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("bad manifest %v: %v", MetaManifest, err)
+	}
+	return m, nil
+}
+
+// GitManifest returns the metadata manifest stored in commit, empty if the
+// commit has none. An empty commit means HEAD.
+func (r GitRepo) GitManifest(commitHash string) (Manifest, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.Head(); err != nil {
+		return Manifest{}, nil
+	}
+	c, err := r.commitFileContent(commitHash, MetaManifest)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return Manifest{}, nil
+	}
+	return parseManifest(c.Data)
+}
+
+// readManifest reads the worktree manifest, empty if there is none
+func (r GitRepo) readManifest() (Manifest, error) {
+	data, err := os.ReadFile(MetaManifest.ToAbs(r))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+// srcMeta reads the metadata to record for src. Unless symlinks are
+// preserved the backup holds the target, so its metadata is used.
+func (r GitRepo) srcMeta(src SrcPath) (FileMeta, error) {
+	path := src.String()
+	if r.Symlinks != SymlinkPreserve {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		}
+	}
+	return statMeta(path)
+}
+
+// staleMeta returns the tracked files below gitpaths whose source metadata
+// differs from the worktree manifest, e.g. after a chown, chmod or xattr
+// change that left the content alone
+func (r GitRepo) staleMeta(repo *git.Repository, gitpaths []RepoPath) ([]RepoPath, error) {
+	m, err := r.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	ret := []RepoPath{}
+	for _, e := range idx.Entries {
+		f := RepoPath(e.Name)
+		if isMetaPath(f) || !slices.ContainsFunc(gitpaths, func(p RepoPath) bool {
+			return p == "" || f == p || strings.HasPrefix(e.Name, p.Sting()+"/")
+		}) {
+			continue
+		}
+		src, err := f.PlatformStyle().ToSrc()
+		if err != nil {
+			return nil, err
+		}
+		meta, err := r.srcMeta(src)
+		if err != nil {
+			// gone at the source, the content side handles it
+			continue
+		}
+		if old, ok := m[f]; !ok || !old.equal(meta) {
+			ret = append(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+// stageMeta records the metadata of the sources of files in the worktree
+// manifest and stages it. Files whose source is gone are dropped.
+func (r GitRepo) stageMeta(w *git.Worktree, files []RepoPath) error {
+	m, err := r.readManifest()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		f = f.UnixStyle()
+		if f == MetaManifest {
+			continue
+		}
+		src, err := f.PlatformStyle().ToSrc()
+		if err != nil {
+			return err
+		}
+		meta, err := r.srcMeta(src)
+		if err != nil {
+			delete(m, f)
+			continue
+		}
+		m[f] = meta
+	}
+	return r.writeManifest(w, m)
+}
+
+// unstageMeta drops files from the worktree manifest and stages it
+func (r GitRepo) unstageMeta(w *git.Worktree, files []RepoPath) error {
+	data, err := os.ReadFile(MetaManifest.ToAbs(r))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m, err := parseManifest(data)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		delete(m, f.UnixStyle())
+	}
+	return r.writeManifest(w, m)
+}
+
+func (r GitRepo) writeManifest(w *git.Worktree, m Manifest) error {
+	manifestPath := MetaManifest.ToAbs(r)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if _, err := w.Add(MetaManifest.Sting()); err != nil {
+		return fmt.Errorf("stage %v: %v", MetaManifest, err)
+	}
+	return nil
+}
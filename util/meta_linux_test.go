@@ -0,0 +1,182 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestGitRestoreMeta(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir := t.TempDir()
+	conf := filepath.Join(srcDir, "app.conf")
+	if err := os.WriteFile(conf, []byte("a=1\n"), 0640); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	mtime := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(conf, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	xattr := true
+	if err := unix.Lsetxattr(conf, "user.origin", []byte("test"), 0); err != nil {
+		t.Logf("xattrs not supported here: %v", err)
+		xattr = false
+	}
+
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	ret, err := r.GitAddFile(gitpath)
+	if err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	for _, f := range ret.Files {
+		if f == MetaManifest {
+			t.Errorf("Expected the manifest not to be reported as backed up file")
+		}
+	}
+	m, err := r.GitManifest("")
+	if err != nil {
+		t.Fatalf("GitManifest failed: %v", err)
+	}
+	name := SrcPath(conf).Repo().UnixStyle()
+	meta, ok := m[name]
+	if !ok {
+		t.Fatalf("Expected %v in manifest, got %v", name, m)
+	}
+	if meta.Uid != os.Getuid() || !meta.Mtime.Equal(mtime) || meta.Mode.Perm() != 0640 {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+
+	if err := os.Remove(conf); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := r.GitRestore(gitpath, "", false); err != nil {
+		t.Fatalf("GitRestore failed: %v", err)
+	}
+	info, err := os.Stat(conf)
+	if err != nil {
+		t.Fatalf("Expected %v to be restored: %v", conf, err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected mtime %v, got %v", mtime, info.ModTime())
+	}
+	if xattr {
+		buf := make([]byte, 16)
+		if n, err := unix.Lgetxattr(conf, "user.origin", buf); err != nil || string(buf[:n]) != "test" {
+			t.Errorf("Expected xattr to be restored, got %q %v", buf[:n], err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out.conf")
+	if _, err := r.GitExportTree(name, "", out); err != nil {
+		t.Fatalf("GitExportTree failed: %v", err)
+	}
+	if info, err := os.Stat(out); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected exported file to keep mtime, got %v %v", info, err)
+	}
+	// the manifest is never restored as a file
+	entries, err := r.GitRestore("", "", true)
+	if err != nil {
+		t.Fatalf("GitRestore failed: %v", err)
+	}
+	for _, e := range entries {
+		if e.Path == MetaManifest {
+			t.Errorf("Expected manifest to be skipped")
+		}
+	}
+}
+
+func TestGitAddMetaOnly(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir := t.TempDir()
+	conf := filepath.Join(srcDir, "app.conf")
+	if err := os.WriteFile(conf, []byte("a=1\n"), 0640); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	if ret, err := r.GitAddFile(gitpath); err != nil || ret.Action != GitResultTypeNochange {
+		t.Fatalf("Expected no change, got %v %v", ret, err)
+	}
+
+	// a touch alone is not committed
+	mtime := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(conf, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if _, err := r.CopyToRepo(SrcPath(srcDir)); err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if ret, err := r.GitAddFile(gitpath); err != nil || ret.Action != GitResultTypeNochange {
+		t.Fatalf("Expected no change after a touch, got %v %v", ret, err)
+	}
+
+	// a chmod leaves the content alone but is committed with the new mtime
+	if err := os.Chmod(conf, 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if _, err := r.CopyToRepo(SrcPath(srcDir)); err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	ret, err := r.GitAddFile(gitpath)
+	if err != nil || ret.Action != GitResultTypeAdd {
+		t.Fatalf("Expected the metadata to be committed, got %v %v", ret, err)
+	}
+	m, err := r.GitManifest("")
+	if err != nil {
+		t.Fatalf("GitManifest failed: %v", err)
+	}
+	meta := m[SrcPath(conf).Repo().UnixStyle()]
+	if !meta.Mtime.Equal(mtime) || meta.Mode.Perm() != 0600 {
+		t.Errorf("Expected the new mtime and mode in the manifest, got %+v", meta)
+	}
+	if ret, err := r.GitAddFile(gitpath); err != nil || ret.Action != GitResultTypeNochange {
+		t.Errorf("Expected no change after the metadata commit, got %v %v", ret, err)
+	}
+}
+
+func TestSrcMetaFollowsSymlink(t *testing.T) {
+	srcDir := t.TempDir()
+	target := filepath.Join(srcDir, "init.lua")
+	if err := os.WriteFile(target, []byte("-- nvim\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := unix.Lsetxattr(target, "user.origin", []byte("target"), 0); err != nil {
+		t.Skipf("xattrs not supported here: %v", err)
+	}
+	link := filepath.Join(srcDir, "vimrc")
+	if err := os.Symlink("init.lua", link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	meta, err := GitRepo{Symlinks: SymlinkFollow}.srcMeta(SrcPath(link))
+	if err != nil {
+		t.Fatalf("srcMeta failed: %v", err)
+	}
+	if string(meta.Xattrs["user.origin"]) != "target" || meta.Mode != 0600 {
+		t.Errorf("Expected the metadata of the target, got %+v", meta)
+	}
+	meta, err = GitRepo{Symlinks: SymlinkPreserve}.srcMeta(SrcPath(link))
+	if err != nil || meta.Mode&os.ModeSymlink == 0 {
+		t.Errorf("Expected the metadata of the link, got %+v %v", meta, err)
+	}
+}
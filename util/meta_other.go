@@ -0,0 +1,13 @@
+//go:build !unix
+
+package util
+
+import "os"
+
+func fileOwner(info os.FileInfo) (uid, gid int, userName, groupName string) {
+	return -1, -1, "", ""
+}
+
+func chownFile(path string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package util
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner returns the owner of a file and, if known, the names
+func fileOwner(info os.FileInfo) (uid, gid int, userName, groupName string) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, "", ""
+	}
+	uid, gid = int(st.Uid), int(st.Gid)
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		userName = u.Username
+	}
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		groupName = g.Name
+	}
+	return
+}
+
+// chownFile sets the owner of path without following symlinks. Nothing is
+// done if the owner is already right, so restoring as a normal user works
+// for the user's own files.
+func chownFile(path string, uid, gid int) error {
+	if uid < 0 || gid < 0 {
+		return nil
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) == uid && int(st.Gid) == gid {
+			return nil
+		}
+	}
+	return os.Lchown(path, uid, gid)
+}
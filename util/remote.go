@@ -0,0 +1,42 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/sirupsen/logrus"
+)
+
+// pushRefSpecs are the refs pushed to a remote
+var pushRefSpecs = []config.RefSpec{"refs/heads/*:refs/heads/*"}
+
+// GitPush pushes every branch to url. The remote is not recorded in the
+// repository; remotes live in the config.
+func (r GitRepo) GitPush(name, url string) error {
+	repo, err := r.Open()
+	if err != nil {
+		return fmt.Errorf("git push %v", err)
+	}
+	remote := git.NewRemote(repo.Storer, &config.RemoteConfig{Name: name, URLs: []string{url}})
+	err = remote.Push(&git.PushOptions{RemoteName: name, RefSpecs: pushRefSpecs})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("git push %v %v: %v", name, url, err)
+	}
+	return nil
+}
+
+// autoPush pushes to every remote with auto_push set. Failures are only
+// logged because the backup itself was committed.
+func (r GitRepo) autoPush() {
+	for _, name := range slices.Sorted(maps.Keys(r.Remotes)) {
+		if remote := r.Remotes[name]; remote.AutoPush {
+			if err := r.GitPush(name, remote.URL); err != nil {
+				logrus.Warnf("auto push: %v", err)
+			}
+		}
+	}
+}
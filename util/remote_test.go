@@ -0,0 +1,125 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v6"
+)
+
+// remoteHead returns the hash of master in the repository at dir
+func remoteHead(t *testing.T, dir string) string {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := repo.Reference("refs/heads/master", true)
+	if err != nil {
+		t.Fatalf("remote has no master: %v", err)
+	}
+	return ref.Hash().String()
+}
+
+func TestGitPush(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	r, _ := setupAddFile(t, repoDir, c)
+	head := remoteHead(t, repoDir)
+
+	for _, url := range []string{"", "file://"} {
+		bare := t.TempDir()
+		if _, err := git.PlainInit(bare, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.GitPush("backup", url+bare); err != nil {
+			t.Fatalf("push to %v%v: %v", url, bare, err)
+		}
+		if got := remoteHead(t, bare); got != head {
+			t.Errorf("remote %v%v at %v, want %v", url, bare, got, head)
+		}
+		// nothing new to push is not an error
+		if err := r.GitPush("backup", url+bare); err != nil {
+			t.Errorf("second push failed: %v", err)
+		}
+	}
+}
+
+func TestAutoPush(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	bare, manual := t.TempDir(), t.TempDir()
+	for _, dir := range []string{bare, manual} {
+		if _, err := git.PlainInit(dir, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Remotes = map[string]Remote{
+		"auto":   {URL: bare, AutoPush: true},
+		"manual": {URL: manual},
+	}
+	r, gitpath := setupAddFile(t, repoDir, c)
+	if got := remoteHead(t, bare); got != remoteHead(t, repoDir) {
+		t.Errorf("auto push after add: remote at %v", got)
+	}
+	if repo, _ := git.PlainOpen(manual); repo != nil {
+		if _, err := repo.Reference("refs/heads/master", true); err == nil {
+			t.Error("remote without auto_push was pushed")
+		}
+	}
+
+	if _, err := r.GitRmFile(gitpath); err != nil {
+		t.Fatal(err)
+	}
+	if got := remoteHead(t, bare); got != remoteHead(t, repoDir) {
+		t.Errorf("auto push after rm: remote at %v", got)
+	}
+
+	// a failing remote does not fail the backup
+	r.Remotes["auto"] = Remote{URL: filepath.Join(repoDir, "missing"), AutoPush: true}
+	add_file(t, repoDir, "other.txt", "other", r)
+}
+
+func TestSetRemote(t *testing.T) {
+	t.Setenv("ANYBAKUP_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	c := &Config{}
+	if err := c.SetProfile("work", Profile{RepoDir: "/work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRemote("work", "origin", Remote{URL: "/srv/work.git", AutoPush: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRemote("", "mirror", Remote{URL: "file:///srv/all.git"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRemote("work", "bad", Remote{}); err == nil {
+		t.Error("expected a remote without url to fail")
+	}
+	if err := c.SetRemote("nope", "origin", Remote{URL: "/srv"}); err == nil {
+		t.Error("expected an unknown profile to fail")
+	}
+
+	loaded := &Config{}
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	p := loaded.GetProfile("work")
+	if len(p.Remotes) != 2 || !p.Remotes["origin"].AutoPush || p.Remotes["mirror"].URL != "file:///srv/all.git" {
+		t.Errorf("unexpected remotes %+v", p.Remotes)
+	}
+	if err := loaded.RemoveRemote("work", "mirror"); err == nil {
+		t.Error("expected removing a global remote from a profile to fail")
+	}
+	if err := loaded.RemoveRemote("work", "origin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Profile["work"].Remotes["origin"]; ok {
+		t.Error("remote not removed")
+	}
+	if err := loaded.RemoveRemote("", "mirror"); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.GetProfile("work").Remotes) != 0 {
+		t.Errorf("global remote not removed %+v", loaded.Remotes)
+	}
+}
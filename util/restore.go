@@ -0,0 +1,241 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/sirupsen/logrus"
+)
+
+// RestoreEntry describes one file written (or to be written) by a restore
+type RestoreEntry struct {
+	Path   RepoPath    `json:"path"`
+	Target string      `json:"target"`
+	Mode   os.FileMode `json:"mode"`
+	Exists bool        `json:"exists"` // Target already exists and is overwritten
+}
+
+// ErrPathNotFound is returned when a path is not part of a commit
+var ErrPathNotFound = errors.New("not found in commit")
+
+// walkCommitTree calls fn for every file below gitpath at the given commit.
+// gitpath may name a single file or a directory; an empty gitpath walks the
+// whole tree. It fails if gitpath is not part of the commit.
+func (r GitRepo) walkCommitTree(commitHash string, gitpath RepoPath, fn func(name RepoPath, f *object.File) error) error {
+	repo, err := r.Open()
+	if err != nil {
+		return err
+	}
+	commit, err := resolveCommit(repo, commitHash)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to get tree: %v", err)
+	}
+	prefix := gitpath.UnixStyle().Sting()
+	if prefix != "" {
+		if file, err := tree.File(prefix); err == nil {
+			return fn(RepoPath(prefix), file)
+		}
+		if tree, err = tree.Tree(prefix); err != nil {
+			return fmt.Errorf("%s %w %s: %v", prefix, ErrPathNotFound, commitHash, err)
+		}
+	}
+	return tree.Files().ForEach(func(f *object.File) error {
+		name := RepoPath(path.Join(prefix, f.Name))
+		if isMetaPath(name) {
+			return nil
+		}
+		return fn(name, f)
+	})
+}
+
+// writeTreeFile materializes a git file at target with the mode stored in git
+// and returns the path holding it. Git symlinks are recreated as symlinks. A
+// symlink at target whose file already holds the contents, as backed up with
+// the follow policy, is kept and the path of its file is returned.
+func writeTreeFile(f *object.File, target string) (string, error) {
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return "", fmt.Errorf("file mode %v: %v", f.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	if f.Mode == filemode.Symlink {
+		// the blob of a git symlink holds the link target
+		link, err := f.Contents()
+		if err != nil {
+			return "", err
+		}
+		if err := removeNonDir(target); err != nil {
+			return "", err
+		}
+		return target, os.Symlink(link, target)
+	}
+	// never write through a symlink found at target
+	if st, err := os.Lstat(target); err == nil && st.Mode()&os.ModeSymlink != 0 {
+		if real, ok := holdsBlob(target, f); ok {
+			return real, nil
+		}
+		logrus.Warnf("replacing symlink %v with the backed up file", target)
+		if err := os.Remove(target); err != nil {
+			return "", err
+		}
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, reader); err != nil {
+		return "", err
+	}
+	// OpenFile keeps the mode of an existing file
+	return target, os.Chmod(target, mode.Perm())
+}
+
+// holdsBlob reports whether the symlink link resolves to a regular file with
+// the contents of f, and returns that file
+func holdsBlob(link string, f *object.File) (string, bool) {
+	real, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return "", false
+	}
+	if st, err := os.Stat(real); err != nil || !st.Mode().IsRegular() || st.Size() != f.Size {
+		return "", false
+	}
+	data, err := os.ReadFile(real)
+	if err != nil {
+		return "", false
+	}
+	contents, err := f.Contents()
+	return real, err == nil && string(data) == contents
+}
+
+// GitRestore writes gitpath (a file or a directory) as stored in commit back
+// to its original source location, see RepoPath.ToSrc. An empty commit means
+// HEAD. Ownership, mtime and xattrs recorded in the metadata manifest are
+// reapplied. With dryRun nothing is written and the entries that would be restored
+// are returned.
+func (r GitRepo) GitRestore(gitpath RepoPath, commitHash string, dryRun bool) ([]RestoreEntry, error) {
+	ret := []RestoreEntry{}
+	manifest, err := r.GitManifest(commitHash)
+	if err != nil {
+		return ret, fmt.Errorf("git restore %v", err)
+	}
+	err = r.walkCommitTree(commitHash, gitpath, func(name RepoPath, f *object.File) error {
+		src, err := name.PlatformStyle().ToSrc()
+		if err != nil {
+			return err
+		}
+		mode, _ := f.Mode.ToOSFileMode()
+		entry := RestoreEntry{Path: name, Target: src.String(), Mode: mode}
+		if _, err := os.Lstat(entry.Target); err == nil {
+			entry.Exists = true
+		}
+		if !dryRun {
+			written, err := writeTreeFile(f, entry.Target)
+			if err != nil {
+				return fmt.Errorf("restore %v: %v", entry.Target, err)
+			}
+			if meta, ok := manifest[name]; ok {
+				applyMeta(written, meta)
+			}
+		}
+		ret = append(ret, entry)
+		return nil
+	})
+	if err != nil {
+		return ret, fmt.Errorf("git restore %v", err)
+	}
+	return ret, nil
+}
+
+// GitExportTree materializes gitpath as stored in commit at outpath, keeping
+// the file modes stored in the git tree and the metadata manifest. A file is written to outpath itself,
+// a directory is written below outpath. An empty commit means HEAD.
+func (r GitRepo) GitExportTree(gitpath RepoPath, commitHash string, outpath string) ([]RestoreEntry, error) {
+	ret := []RestoreEntry{}
+	prefix := gitpath.UnixStyle().Sting()
+	manifest, err := r.GitManifest(commitHash)
+	if err != nil {
+		return ret, fmt.Errorf("git export %v", err)
+	}
+	err = r.walkCommitTree(commitHash, gitpath, func(name RepoPath, f *object.File) error {
+		target := outpath
+		if rel := strings.TrimPrefix(strings.TrimPrefix(name.Sting(), prefix), "/"); rel != "" {
+			target = filepath.Join(outpath, filepath.FromSlash(rel))
+		}
+		mode, _ := f.Mode.ToOSFileMode()
+		entry := RestoreEntry{Path: name, Target: target, Mode: mode}
+		if _, err := os.Lstat(target); err == nil {
+			entry.Exists = true
+		}
+		written, err := writeTreeFile(f, target)
+		if err != nil {
+			return fmt.Errorf("export %v: %v", target, err)
+		}
+		if meta, ok := manifest[name]; ok {
+			applyMeta(written, meta)
+		}
+		ret = append(ret, entry)
+		return nil
+	})
+	if err != nil {
+		return ret, fmt.Errorf("git export %v", err)
+	}
+	return ret, nil
+}
+
+// GitResolveRevision returns the hash of the commit rev names
+func (r GitRepo) GitResolveRevision(rev string) (string, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return "", err
+	}
+	commit, err := resolveCommit(repo, rev)
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// GitCommitAt returns the newest commit touching gitpath made at or before at
+func (r GitRepo) GitCommitAt(gitpath RepoPath, at time.Time) (string, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return "", fmt.Errorf("git commit at %v", err)
+	}
+	gitfile := gitpath.UnixStyle().Sting()
+	commitIter, err := repo.Log(&git.LogOptions{
+		PathFilter: pathFilter(gitfile),
+		Until:      &at,
+		Order:      git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return "", fmt.Errorf("git commit at: failed to get log: %v", err)
+	}
+	defer commitIter.Close()
+	c, err := commitIter.Next()
+	if err != nil {
+		return "", fmt.Errorf("no commit found for %s at or before %s", gitfile, at.Format("2006-01-02 15:04:05"))
+	}
+	return c.Hash.String(), nil
+}
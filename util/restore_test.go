@@ -0,0 +1,161 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGitRestore(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir, err := os.MkdirTemp("", "test-src-*")
+	if err != nil {
+		t.Fatalf("Failed to create src dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	script := filepath.Join(srcDir, "bin", "run.sh")
+	conf := filepath.Join(srcDir, "conf.ini")
+	if err := os.MkdirAll(filepath.Dir(script), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(conf, []byte("a=1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+
+	if err := os.WriteFile(conf, []byte("a=2\n"), 0600); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Dir(script)); err != nil {
+		t.Fatalf("Failed to remove dir: %v", err)
+	}
+
+	entries, err := r.GitRestore(gitpath, "", true)
+	if err != nil {
+		t.Fatalf("GitRestore dry run failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %v", entries)
+	}
+	for _, e := range entries {
+		if e.Target == conf && !e.Exists {
+			t.Errorf("Expected %v to be reported as overwritten", conf)
+		}
+		if e.Target == script && e.Exists {
+			t.Errorf("Expected %v to be reported as created", script)
+		}
+	}
+	if _, err := os.Stat(script); !os.IsNotExist(err) {
+		t.Fatal("Dry run must not write files")
+	}
+
+	if _, err := r.GitRestore(gitpath, "", false); err != nil {
+		t.Fatalf("GitRestore failed: %v", err)
+	}
+	if content, err := os.ReadFile(conf); err != nil || string(content) != "a=1\n" {
+		t.Errorf("Expected restored content, got %q %v", content, err)
+	}
+	if st, err := os.Stat(conf); err != nil || st.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v %v", st.Mode(), err)
+	}
+	if st, err := os.Stat(script); err != nil || st.Mode().Perm() != 0755 {
+		t.Errorf("Expected executable script, got %v", err)
+	}
+
+	if _, err := r.GitRestore("nonexistent", "", true); err == nil {
+		t.Error("Expected error for path not in commit")
+	}
+}
+
+func TestGitCommitAt(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	add_file(t, repoDir, "test.txt", "version 1", r)
+	add_file(t, repoDir, "test.txt", "version 2", r)
+	changes, err := r.GitLogFile("test.txt")
+	if err != nil {
+		t.Fatalf("GitLogFile failed: %v", err)
+	}
+
+	commit, err := r.GitCommitAt("test.txt", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GitCommitAt failed: %v", err)
+	}
+	if commit != changes[0].Commit {
+		t.Errorf("Expected newest commit %v, got %v", changes[0].Commit, commit)
+	}
+	if _, err := r.GitCommitAt("test.txt", time.Now().Add(-time.Hour)); err == nil {
+		t.Error("Expected error for time before the first backup")
+	}
+}
+
+func TestGitExportTree(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	dir := filepath.Join(repoDir, "dir1", "sub")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	add_file(t, repoDir, "dir1/a.txt", "a v1", r)
+	if err := os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := r.GitAddFile("dir1"); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	changes, err := r.GitLogPath("dir1")
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("Expected 2 commits for dir1, got %v %v", changes, err)
+	}
+	add_file(t, repoDir, "dir1/a.txt", "a v2", r)
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	entries, err := r.GitExportTree("dir1", changes[0].Commit, outDir)
+	if err != nil {
+		t.Fatalf("GitExportTree failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 exported files, got %v", entries)
+	}
+	if content, err := os.ReadFile(filepath.Join(outDir, "a.txt")); err != nil || string(content) != "a v1" {
+		t.Errorf("Expected historical content, got %q %v", content, err)
+	}
+	if st, err := os.Stat(filepath.Join(outDir, "sub", "run.sh")); err != nil || st.Mode().Perm() != 0755 {
+		t.Errorf("Expected executable mode to be kept, got %v", err)
+	}
+
+	outFile := filepath.Join(outDir, "single.txt")
+	if _, err := r.GitExportTree("dir1/a.txt", "", outFile); err != nil {
+		t.Fatalf("GitExportTree file failed: %v", err)
+	}
+	if content, err := os.ReadFile(outFile); err != nil || string(content) != "a v2" {
+		t.Errorf("Expected HEAD content, got %q %v", content, err)
+	}
+}
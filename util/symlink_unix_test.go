@@ -0,0 +1,175 @@
+//go:build unix
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// makeDotfiles creates a tree with a file, symlinks and a fifo
+func makeDotfiles(t *testing.T) string {
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "nvim"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "nvim", "init.lua"), []byte("-- nvim\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	for link, target := range map[string]string{
+		"vimrc":    "nvim/init.lua",
+		"vim":      "nvim",
+		"dangling": "missing",
+	} {
+		if err := os.Symlink(target, filepath.Join(srcDir, link)); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+	if err := syscall.Mkfifo(filepath.Join(srcDir, "fifo"), 0644); err != nil {
+		t.Fatalf("Failed to create fifo: %v", err)
+	}
+	return srcDir
+}
+
+// TestCopyToRepo_Symlinks tests the symlink policies
+func TestCopyToRepo_Symlinks(t *testing.T) {
+	srcDir := makeDotfiles(t)
+	for _, policy := range []SymlinkPolicy{SymlinkPreserve, SymlinkFollow, SymlinkSkip} {
+		t.Run(string(policy), func(t *testing.T) {
+			r := &GitRepo{root: t.TempDir(), Symlinks: policy}
+			gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+			if err != nil {
+				t.Fatalf("CopyToRepo failed: %v", err)
+			}
+			dest := gitpath.ToAbs(*r)
+			if _, err := os.Lstat(filepath.Join(dest, "fifo")); !os.IsNotExist(err) {
+				t.Errorf("Expected fifo to be skipped, got %v", err)
+			}
+			vimrc, vimrcErr := os.Lstat(filepath.Join(dest, "vimrc"))
+			_, danglingErr := os.Lstat(filepath.Join(dest, "dangling"))
+			vim, vimErr := os.Lstat(filepath.Join(dest, "vim"))
+			switch policy {
+			case SymlinkPreserve:
+				if vimrcErr != nil || vimrc.Mode()&os.ModeSymlink == 0 || danglingErr != nil {
+					t.Errorf("Expected symlinks to be preserved: %v %v %v", vimrc, vimrcErr, danglingErr)
+				}
+				if target, _ := os.Readlink(filepath.Join(dest, "vim")); target != "nvim" {
+					t.Errorf("Expected link target nvim, got %q", target)
+				}
+			case SymlinkFollow:
+				if vimrcErr != nil || !vimrc.Mode().IsRegular() || vimErr != nil || !vim.IsDir() {
+					t.Errorf("Expected symlinks to be followed: %v %v %v %v", vimrc, vimrcErr, vim, vimErr)
+				}
+				if !os.IsNotExist(danglingErr) {
+					t.Errorf("Expected dangling symlink to be skipped, got %v", danglingErr)
+				}
+			case SymlinkSkip:
+				if !os.IsNotExist(vimrcErr) || !os.IsNotExist(vimErr) || !os.IsNotExist(danglingErr) {
+					t.Errorf("Expected symlinks to be skipped: %v %v %v", vimrcErr, vimErr, danglingErr)
+				}
+			}
+		})
+	}
+	if _, err := (&GitRepo{root: t.TempDir()}).CopyToRepo(SrcPath(filepath.Join(srcDir, "fifo"))); err == nil {
+		t.Error("Expected copying a fifo to fail")
+	}
+}
+
+func TestGitRestoreSymlinks(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	c.Symlinks = string(SymlinkPreserve)
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir := makeDotfiles(t)
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+	if diff, err := r.GitDriftSrc(SrcPath(srcDir), DefaultDiffContext); err != nil || diff != "" {
+		t.Errorf("Expected no drift, got %q %v", diff, err)
+	}
+
+	for _, name := range []string{"vimrc", "vim", "dangling", "fifo"} {
+		os.Remove(filepath.Join(srcDir, name))
+	}
+	// a file in place of a link is replaced, not written through
+	if err := os.WriteFile(filepath.Join(srcDir, "vimrc"), []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := r.GitRestore(gitpath, "", false); err != nil {
+		t.Fatalf("GitRestore failed: %v", err)
+	}
+	for link, target := range map[string]string{"vimrc": "nvim/init.lua", "vim": "nvim", "dangling": "missing"} {
+		if got, err := os.Readlink(filepath.Join(srcDir, link)); err != nil || got != target {
+			t.Errorf("Expected %v -> %v, got %q %v", link, target, got, err)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(srcDir, "nvim", "init.lua")); err != nil || string(b) != "-- nvim\n" {
+		t.Errorf("Expected link target untouched, got %q %v", b, err)
+	}
+}
+
+// TestGitRestoreFollowedSymlinks tests that restoring a tree backed up with
+// the follow policy keeps the links whose file holds the backup
+func TestGitRestoreFollowedSymlinks(t *testing.T) {
+	_, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	c.Symlinks = string(SymlinkFollow)
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatalf("NewGitReop failed: %v", err)
+	}
+	srcDir := makeDotfiles(t)
+	gitpath, err := r.CopyToRepo(SrcPath(srcDir))
+	if err != nil {
+		t.Fatalf("CopyToRepo failed: %v", err)
+	}
+	if _, err := r.GitAddFile(gitpath); err != nil {
+		t.Fatalf("GitAddFile failed: %v", err)
+	}
+
+	// the restore puts back init.lua, which vimrc points to
+	initLua := filepath.Join(srcDir, "nvim", "init.lua")
+	if err := os.WriteFile(initLua, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := r.GitRestore(gitpath, "", false); err != nil {
+		t.Fatalf("GitRestore failed: %v", err)
+	}
+	if got, err := os.Readlink(filepath.Join(srcDir, "vimrc")); err != nil || got != "nvim/init.lua" {
+		t.Errorf("Expected vimrc to stay a link, got %q %v", got, err)
+	}
+	if b, err := os.ReadFile(initLua); err != nil || string(b) != "-- nvim\n" {
+		t.Errorf("Expected init.lua to be restored, got %q %v", b, err)
+	}
+
+	// a link to a different file is replaced by the backed up file
+	other := filepath.Join(srcDir, "other")
+	if err := os.WriteFile(other, []byte("other"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	vimrc := filepath.Join(srcDir, "vimrc")
+	if err := os.Remove(vimrc); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := os.Symlink("other", vimrc); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := r.GitRestore(gitpath, "", false); err != nil {
+		t.Fatalf("GitRestore failed: %v", err)
+	}
+	if info, err := os.Lstat(vimrc); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Expected vimrc to be replaced by a file, got %v %v", info, err)
+	}
+	if b, err := os.ReadFile(other); err != nil || string(b) != "other" {
+		t.Errorf("Expected the old link target untouched, got %q %v", b, err)
+	}
+}
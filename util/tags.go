@@ -0,0 +1,230 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// TagManifest is the repo path of the committed tags of the tracked paths,
+// so tags survive clone and reindex and old versions can be found by tag
+const TagManifest RepoPath = metaDir + "tags.json"
+
+// isMetaPath reports whether p is one of the manifests of the repository
+func isMetaPath(p RepoPath) bool {
+	return strings.HasPrefix(p.UnixStyle().Sting(), metaDir)
+}
+
+// Tags maps unix style repo paths to their tag. A path without an entry has
+// the tag of the closest directory above it.
+type Tags map[RepoPath]string
+
+// Of returns the tag of p
+func (t Tags) Of(p RepoPath) string {
+	for p = p.UnixStyle(); ; p = RepoPath(path.Dir(p.Sting())) {
+		if tag, ok := t[p]; ok {
+			return tag
+		}
+		if p == "." || p == "/" || p == "" {
+			return ""
+		}
+	}
+}
+
+// drop removes the entries of paths and of everything below them
+func (t Tags) drop(paths ...RepoPath) {
+	for _, p := range paths {
+		p = p.UnixStyle()
+		maps.DeleteFunc(t, func(k RepoPath, _ string) bool {
+			return k == p || strings.HasPrefix(k.Sting(), p.Sting()+"/")
+		})
+	}
+}
+
+// set tags paths and everything below them; an empty tag removes the tag.
+// Entries equal to the inherited tag are left out.
+func (t Tags) set(tag string, paths ...RepoPath) {
+	for _, p := range paths {
+		p = p.UnixStyle()
+		t.drop(p)
+		if t.Of(p) != tag {
+			t[p] = tag
+		}
+	}
+}
+
+func parseTags(data []byte) (Tags, error) {
+	t := Tags{}
+	if len(data) == 0 {
+		return t, nil
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("bad manifest %v: %v", TagManifest, err)
+	}
+	return t, nil
+}
+
+// GitTags returns the tags stored in commit, empty if the commit has none.
+// An empty commit means HEAD.
+func (r GitRepo) GitTags(commitHash string) (Tags, error) {
+	repo, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.Head(); err != nil {
+		return Tags{}, nil
+	}
+	c, err := r.commitFileContent(commitHash, TagManifest)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return Tags{}, nil
+	}
+	return parseTags(c.Data)
+}
+
+// commitTags reads the tag manifest from the tree of c
+func commitTags(c *object.Commit) (Tags, error) {
+	f, err := c.File(TagManifest.Sting())
+	if errors.Is(err, object.ErrFileNotFound) {
+		return Tags{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git tags %v: %v", c.Hash, err)
+	}
+	data, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("git tags %v: %v", c.Hash, err)
+	}
+	return parseTags([]byte(data))
+}
+
+// stageTags applies fn to the worktree tags and stages them when they
+// changed. It reports whether they changed.
+func (r GitRepo) stageTags(w *git.Worktree, fn func(Tags)) (bool, error) {
+	file := TagManifest.ToAbs(r)
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	t, err := parseTags(data)
+	if err != nil {
+		return false, err
+	}
+	old := maps.Clone(t)
+	fn(t)
+	if maps.Equal(old, t) {
+		return false, nil
+	}
+	if data, err = json.MarshalIndent(t, "", "  "); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0o644); err != nil {
+		return false, err
+	}
+	if _, err := w.Add(TagManifest.Sting()); err != nil {
+		return false, fmt.Errorf("stage %v: %v", TagManifest, err)
+	}
+	return true, nil
+}
+
+// GitSetTag tags paths, see Tags, and commits the tag manifest. Nothing is
+// committed when the tags do not change.
+func (r GitRepo) GitSetTag(tag string, paths ...RepoPath) (GitResult, error) {
+	ret := GitResult{Action: GitResultTypeError}
+	if len(paths) == 0 {
+		ret.Action = GitResultTypeNochange
+		return ret, nil
+	}
+	repo, err := r.Open()
+	if err != nil {
+		return ret, fmt.Errorf("git tag %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return ret, fmt.Errorf("git tag %v", err)
+	}
+	changed, err := r.stageTags(w, func(t Tags) { t.set(tag, paths...) })
+	if err != nil {
+		return ret, fmt.Errorf("git tag %v", err)
+	}
+	if !changed {
+		ret.Action = GitResultTypeNochange
+		return ret, nil
+	}
+	msg := fmt.Sprintf("TAG %v [%v]", paths[0].UnixStyle(), tag)
+	if len(paths) > 1 {
+		msg = fmt.Sprintf("TAG %d paths [%v]\n", len(paths), tag)
+		for _, p := range paths {
+			msg += fmt.Sprintf("\n%v", p.UnixStyle())
+		}
+	}
+	if _, err := w.Commit(msg, &git.CommitOptions{Author: r.signature()}); err != nil {
+		return ret, fmt.Errorf("git commit %v %v", err, paths)
+	}
+	ret.Action = GitResultTypeAdd
+	ret.Files = paths
+	r.autoPush()
+	return ret, nil
+}
+
+// TaggedCommit is a commit changing files that had the searched tag
+type TaggedCommit struct {
+	GitChanges
+	Files []RepoPath `json:"files"`
+}
+
+// GitTagHistory searches the history for versions of files tagged tag,
+// newest first. The tags of each commit are those committed with it.
+func (r GitRepo) GitTagHistory(tag string) ([]TaggedCommit, error) {
+	commits, err := r.headCommits()
+	if err != nil {
+		return nil, err
+	}
+	ret := []TaggedCommit{}
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		tags, err := commitTags(c)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := commitChanges(c)
+		if err != nil {
+			return nil, err
+		}
+		files := []RepoPath{}
+		for _, change := range changes {
+			// deletions are not versions
+			name := RepoPath(change.To.Name)
+			if name == "" || isMetaPath(name) || tags.Of(name) != tag {
+				continue
+			}
+			files = append(files, name)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		ret = append(ret, TaggedCommit{
+			GitChanges: GitChanges{
+				Commit:  c.Hash.String(),
+				Author:  c.Author.Name,
+				Date:    c.Author.When.Format("2006-01-02 15:04:05"),
+				Message: c.Message,
+			},
+			Files: files,
+		})
+	}
+	return ret, nil
+}
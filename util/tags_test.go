@@ -0,0 +1,94 @@
+package util
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	tags := Tags{}
+	tags.set("work", "home/u/docs")
+	tags.set("x", "home/u/docs/a.txt")
+	if got := tags.Of("home/u/docs/b.txt"); got != "work" {
+		t.Errorf("inherited tag %q", got)
+	}
+	if got := tags.Of("home/u/docs/a.txt"); got != "x" {
+		t.Errorf("own tag %q", got)
+	}
+	if got := tags.Of("home/u/other"); got != "" {
+		t.Errorf("untagged path has tag %q", got)
+	}
+	// setting the inherited tag needs no entry
+	tags.set("work", "home/u/docs/b.txt")
+	// tagging a directory overrides the tags below it
+	tags.set("all", "home/u")
+	if want := (Tags{"home/u": "all"}); !maps.Equal(tags, want) {
+		t.Errorf("got %v, want %v", tags, want)
+	}
+	tags.set("", "home/u/docs")
+	if got := tags.Of("home/u/docs/a.txt"); got != "" {
+		t.Errorf("removed tag still %q", got)
+	}
+	tags.drop("home/u")
+	if len(tags) != 0 {
+		t.Errorf("drop left %v", tags)
+	}
+}
+
+func TestGitTags(t *testing.T) {
+	repoDir, c, cleanup := setupGitTestEnv(t)
+	defer cleanup()
+	r, err := NewGitReop(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add_file(t, repoDir, "a.txt", "a", r)
+	if ret, err := r.GitSetTag("work", "a.txt"); err != nil || ret.Action != GitResultTypeAdd {
+		t.Fatalf("tag: %v %v", ret, err)
+	}
+	if ret, err := r.GitSetTag("work", "a.txt"); err != nil || ret.Action != GitResultTypeNochange {
+		t.Errorf("tag again: %v %v", ret, err)
+	}
+	if tags, err := r.GitTags(""); err != nil || tags.Of("a.txt") != "work" {
+		t.Errorf("committed tags %v %v", tags, err)
+	}
+
+	// add commits the tag together with the file
+	if err := os.WriteFile(filepath.Join(repoDir, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GitAddFile("b.txt", "home"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := r.GitTags(""); err != nil || tags.Of("b.txt") != "home" {
+		t.Errorf("committed tags %v %v", tags, err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GitAddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := r.GitTagHistory("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first version of a.txt was committed before it was tagged
+	if len(history) != 1 || !slices.Equal(history[0].Files, []RepoPath{"a.txt"}) {
+		t.Errorf("unexpected history %+v", history)
+	}
+
+	if _, err := r.GitRmFile("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := r.GitTags(""); err != nil || tags.Of("b.txt") != "" {
+		t.Errorf("tag of removed file kept %v %v", tags, err)
+	}
+	if files, err := r.GitHeadFiles(); err != nil || !slices.Equal(files, []RepoPath{"a.txt"}) {
+		t.Errorf("manifest listed as file %v %v", files, err)
+	}
+}
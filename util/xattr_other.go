@@ -0,0 +1,11 @@
+//go:build !(linux || darwin)
+
+package util
+
+func getXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return nil
+}